@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// batcher groups bets into batch messages of at most maxAmount bets whose
+// frame is at most maxBytes long, cutting a batch on whichever limit is hit
+// first.
+type batcher struct {
+	maxAmount int
+	maxBytes  int
+	bets      []string
+	length    int
+}
+
+// newBatcher creates a batcher with the given limits, see setLimits.
+func newBatcher(maxAmount int, maxBytes int) *batcher {
+	b := &batcher{}
+	b.setLimits(maxAmount, maxBytes)
+	return b
+}
+
+// setLimits changes the limits of the batches, starting with the next bet
+// added. A maxBytes that is not positive or exceeds the frame limit of the
+// protocol is set to that limit.
+func (b *batcher) setLimits(maxAmount int, maxBytes int) {
+	if maxAmount < 1 {
+		maxAmount = 1
+	}
+	if maxBytes <= 0 || maxBytes > common.MaxFrameSize {
+		maxBytes = common.MaxFrameSize
+	}
+	b.maxAmount = maxAmount
+	b.maxBytes = maxBytes
+}
+
+// add adds a bet, encoded with common.EncodeBet, and returns the batches
+// that are ready to be sent, if any. A bet that does not fit in the batch in
+// progress starts the next one. A bet whose frame alone exceeds maxBytes is
+// not added and an error wrapping ErrBetTooLarge is returned.
+func (b *batcher) add(bet string) ([]string, error) {
+	if size := batchFrameSize(len(bet)); size > b.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrBetTooLarge, size, b.maxBytes)
+	}
+	var ready []string
+	// the batch in progress may be full already if the limits were lowered
+	if len(b.bets) > 0 && (len(b.bets) >= b.maxAmount || batchFrameSize(b.length+len(bet)) > b.maxBytes) {
+		ready = append(ready, b.flush())
+	}
+	b.bets = append(b.bets, bet)
+	b.length += len(bet)
+	if len(b.bets) >= b.maxAmount {
+		ready = append(ready, b.flush())
+	}
+	return ready, nil
+}
+
+// flush returns the message of the batch in progress, which is empty if no
+// bet is pending, and starts a new one.
+func (b *batcher) flush() string {
+	if len(b.bets) == 0 {
+		return ""
+	}
+	batch := common.BatchMessage(strings.Join(b.bets, ""))
+	b.bets = nil
+	b.length = 0
+	return batch
+}
+
+// batchFrameSize returns the size of the frame of a batch message whose bets
+// are betsLength bytes long.
+func batchFrameSize(betsLength int) int {
+	return common.FrameSize(len(common.BatchMessage("")) + betsLength)
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// errInvalidBet is returned for a row of the bets file that can not be read
+// as a bet. The following rows can still be read.
+var errInvalidBet = errors.New("invalid bet format")
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// betsReader reads the bets of an agency from a CSV file with the columns
+// first name, last name, document, birthdate, number and, optionally, stake.
+// Fields may be quoted, lines may end in CRLF, and the file may start with a
+// UTF-8 BOM and a header row, which are skipped.
+type betsReader struct {
+	reader *csv.Reader
+	first  bool
+}
+
+func newBetsReader(file io.Reader) *betsReader {
+	buffered := bufio.NewReader(file)
+	if prefix, err := buffered.Peek(len(utf8BOM)); err == nil && bytes.Equal(prefix, utf8BOM) {
+		buffered.Discard(len(utf8BOM))
+	}
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	return &betsReader{reader: reader, first: true}
+}
+
+// next returns the fields of the next bet, or io.EOF once there are none
+// left. A row that is not a bet returns an error wrapping errInvalidBet.
+func (r *betsReader) next() ([]string, error) {
+	for {
+		fields, err := r.reader.Read()
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return nil, fmt.Errorf("%w: %v", errInvalidBet, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		first := r.first
+		r.first = false
+		if first && isHeader(fields) {
+			continue
+		}
+		if len(fields) != 5 && len(fields) != 6 {
+			line, _ := r.reader.FieldPos(0)
+			return nil, fmt.Errorf("%w: line %d: expected 5 or 6 fields, got %d", errInvalidBet, line, len(fields))
+		}
+		return fields, nil
+	}
+}
+
+// isHeader tells whether a row is a header rather than a bet, which is the
+// case when its number column is not a number.
+func isHeader(fields []string) bool {
+	if len(fields) < 5 {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimSpace(fields[4]))
+	return err != nil
+}
@@ -1,266 +1,543 @@
 package common
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
-	"github.com/op/go-logging"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+	metrics "github.com/7574-sistemas-distribuidos/docker-compose-init/metrics/common"
 )
 
-var log = logging.MustGetLogger("log")
+var log = logger.New()
 
-// ClientConfig Configuration used by the client
+// ErrRejectedByServer is returned when the server answers a request with an
+// error message instead of the expected response. Retrying will not help.
+var ErrRejectedByServer = errors.New("rejected by server")
+
+// ClientConfig Configuration used by the client. LoopPeriod is the first
+// wait between two winners requests while the draw was not performed, and
+// LoopAmount how many failed winners requests in a row are tolerated. Retry
+// is the policy failed requests are retried with.
 type ClientConfig struct {
-	ID             string
-	ServerAddress  string
-	LoopAmount     int
-	LoopPeriod     time.Duration
-	BatchMaxAmount int
+	ID               string
+	ServerAddress    string
+	LoopAmount       int
+	LoopPeriod       time.Duration
+	BatchMaxAmount   int
+	BatchMaxBytes    int
+	ReceiptKey       string
+	ReadinessTimeout time.Duration
+	DataFile         string
+	Retry            RetryPolicy
 }
 
 // Client Entity that encapsulates how
+// Every request is sent on its own connection, which is closed as soon as
+// the client is stopped through ctx.
 type Client struct {
-	config  ClientConfig
-	conn    net.Conn
-	Running bool
+	config     ClientConfig
+	configLock sync.Mutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	ledger     *betLedger
+	metrics    *clientMetrics
 }
 
 // NewClient Initializes a new client receiving the configuration
 // as a parameter
 func NewClient(config ClientConfig) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
 	client := &Client{
 		config:  config,
-		Running: true,
-		// fileReader: nil,
+		ctx:     ctx,
+		cancel:  cancel,
+		ledger:  newBetLedger(),
+		metrics: newClientMetrics(),
 	}
 
 	return client
 }
 
-// CreateClientSocket Initializes client socket. In case of
-// failure, error is printed in stdout/stderr and exit 1
-// is returned
-func (c *Client) createClientSocket() error {
-	if c.Running {
-		conn, err := net.Dial("tcp", c.config.ServerAddress)
-		if err != nil {
-			return err
+// IsRunning tells whether the client was not stopped yet.
+func (c *Client) IsRunning() bool {
+	return c.ctx.Err() == nil
+}
+
+// connect opens a connection to the server that is closed as soon as the
+// client is stopped. The returned function closes it, and must be called
+// once the connection is no longer needed.
+func (c *Client) connect() (net.Conn, func(), error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(c.ctx, "tcp", c.config.ServerAddress)
+	if err != nil {
+		return nil, nil, &dialError{err: err}
+	}
+	c.metrics.connectionsOpened.Inc()
+	conn = metrics.CountBytes(conn, c.metrics.bytesReceived, c.metrics.bytesSent)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	closeConnection := func() {
+		close(done)
+		if err_closing := conn.Close(); err_closing != nil && c.IsRunning() {
+			log.Error("connection closed", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_closing))
+			return
 		}
-		c.conn = conn
+		log.Info("connection closed", "success", logger.F("client_id", c.config.ID))
+	}
+	return conn, closeConnection, nil
+}
+
+// request sends the message on a new connection and returns the answer of
+// the server.
+func (c *Client) request(msg string) (string, error) {
+	conn, closeConnection, err_connecting := c.connect()
+	if err_connecting != nil {
+		return "", err_connecting
+	}
+	defer closeConnection()
+
+	if err_sending_msg := common.SendMessage(conn, msg); err_sending_msg != nil {
+		return "", err_sending_msg
+	}
+	return common.ReadReply(conn)
+}
+
+// sleep waits for the duration, returning false if the client is stopped
+// before it passes.
+func (c *Client) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.ctx.Done():
+		return false
 	}
-	return nil
 }
 
 // StartClientLoop Send messages to the client until some time threshold is met
 func (c *Client) StartClientLoop() {
 	// There is an autoincremental msgID to identify every message sent
 	// Messages if the message amount threshold has not been surpassed
-	if c.Running {
+	if c.IsRunning() && c.config.ReadinessTimeout > 0 {
+		if err_waiting := c.WaitUntilReady(c.config.ReadinessTimeout); err_waiting != nil {
+			if c.IsRunning() {
+				log.Error("esperar_servidor", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_waiting))
+			}
+			log.Info("loop_finished", "success", logger.F("client_id", c.config.ID))
+			return
+		}
+	}
+	if c.IsRunning() {
 		c.SendBatchMessages()
+		if c.IsRunning() {
+			err_reconciling := c.retry(c.retryPolicy(), "conciliacion", isRetryable, c.Reconcile)
+			if err_reconciling != nil && c.IsRunning() {
+				log.Error("conciliacion", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_reconciling))
+			}
+		}
 
-		intentos := 0
-		for intentos < c.config.LoopAmount && c.Running {
-			err_wating_winners := c.WaitForWinners()
-			if err_wating_winners != nil {
-				if c.Running {
-					log.Errorf("action: waiting_winners | result: fail | client_id: %v | error: %v", c.config.ID, err_wating_winners)
-					intentos++
-				}
-			} else {
-				break
+		if c.IsRunning() {
+			if err_wating_winners := c.WaitForWinners(); err_wating_winners != nil && c.IsRunning() {
+				log.Error("waiting_winners", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_wating_winners))
 			}
 		}
 	}
-	log.Infof("action: loop_finished | result: success | client_id: %v", c.config.ID)
+	log.Info("loop_finished", "success", logger.F("client_id", c.config.ID))
 }
 
-func (c *Client) StopClient() {
-	c.Running = false
-	if c.conn != nil {
-		err := c.conn.Close()
-		if err != nil {
-			log.Errorf("action: connection closed | result: fail | client_id: %v | signal: %v", c.config.ID, err)
-		} else {
-			log.Infof("action: graceful_shutdown client connection | result: success | client_id: %v", c.config.ID)
-		}
-		c.conn = nil
-	}
+// Stop stops the client, aborting the request in progress, if any, and
+// making the loop return as soon as possible. It can be called from any
+// goroutine, and more than once.
+func (c *Client) Stop() {
+	c.cancel()
+	log.Info("graceful_shutdown", "success", logger.F("client_id", c.config.ID))
+}
 
-	log.Infof("action: graceful_shutdown | result: success | client_id: %v", c.config.ID)
+// dataFile returns the path of the file with the bets of the agency.
+func (c *Client) dataFile() string {
+	if c.config.DataFile != "" {
+		return c.config.DataFile
+	}
+	return fmt.Sprintf(".data/agency-%s.csv", c.config.ID)
 }
 
+// SendBatchMessages sends the bets of the agency in batches of up to
+// BatchMaxAmount bets whose frame is up to BatchMaxBytes long; both limits
+// are read again for every bet, so a reload applies to the next batch. Bets
+// that do not fit alone in a frame are skipped. A batch that could not be
+// delivered is sent again as the retry policy says; if it still can not be
+// sent, or it failed after reaching the server, the remaining ones are not
+// sent either. Every bet read, sent or not, is added to the ledger unless
+// the server rejected it, so that Reconcile detects the bets that were never
+// stored.
 func (c *Client) SendBatchMessages() {
-	filePath := fmt.Sprintf(".data/agency-%s.csv", c.config.ID)
-	readFile, err_opening_file := os.Open(filePath)
+	readFile, err_opening_file := os.Open(c.dataFile())
 	if err_opening_file != nil {
-		log.Errorf("action: sending batch message | client_id: %v | result: fail | error : %v", c.config.ID, err_opening_file)
+		log.Error("sending batch message", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_opening_file))
+		return
 	}
 
 	defer func() {
 		if error_closing_file := readFile.Close(); error_closing_file != nil {
-			log.Errorf("action: closing file | result: fail | client_id: %v | error: %v", c.config.ID, error_closing_file)
+			log.Error("closing file", "fail", logger.F("client_id", c.config.ID), logger.F("error", error_closing_file))
 		} else {
-			log.Infof("action: closing file | result: success | client_id: %v ", c.config.ID)
+			log.Info("closing file", "success", logger.F("client_id", c.config.ID))
 		}
 	}()
 
-	fileScanner := bufio.NewScanner(readFile)
-	fileScanner.Split(bufio.ScanLines)
-
-	msg := ""
-	batchSize := 0
-
-	for fileScanner.Scan() && c.Running {
-		fileLine := fileScanner.Text()
-		bet := strings.Split(fileLine, ",")
-		if len(bet) != 5 {
-			log.Errorf("action: sending batch message | result: fail | client_id: %v | error: invalid bet format", c.config.ID)
+	bets := newBetsReader(readFile)
+	batches := newBatcher(c.batchLimits())
+	sending := true
+	for c.IsRunning() {
+		bet, err_reading := bets.next()
+		if err_reading == io.EOF {
+			break
+		}
+		if err_reading != nil {
+			log.Error("sending batch message", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_reading))
+			if errors.Is(err_reading, errInvalidBet) {
+				continue
+			}
+			break
+		}
+		// the optional sixth column is the stake of the bet
+		fields := append([]string{c.config.ID}, bet...)
+		if !sending {
+			c.ledger.add(fields)
 			continue
 		}
-		msg += fmt.Sprintf("%s,%s,%s,%s,%s,%s;", c.config.ID, bet[0], bet[1], bet[2], bet[3], bet[4])
-		if batchSize == 0 {
-			err_creating_client := c.createClientSocket()
-			if err_creating_client != nil {
-				if c.Running {
-					log.Errorf("action: sending batch message | result: fail | client_id: %v | error: %v", c.config.ID, err_creating_client)
-				}
-				return
+		// the limits may be changed by a reload while the bets are sent
+		batches.setLimits(c.batchLimits())
+		ready, err_batching := batches.add(common.EncodeBet(fields))
+		if err_batching != nil {
+			log.Error("sending batch message", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_batching))
+			c.ledger.add(fields)
+			continue
+		}
+		for _, batch := range ready {
+			if sending {
+				sending = c.sendBatch(batch) == nil
+			} else {
+				c.ledger.addBatch(batch, nil)
 			}
-			batchSize++
-		} else if batchSize < c.config.BatchMaxAmount-1 {
-			batchSize++
-		} else {
-			c.SendBatchMessage(msg[0 : len(msg)-1])
-			batchSize = 0
-			msg = ""
 		}
 	}
 
-	if len(msg) > 0 && c.Running {
-		c.SendBatchMessage(msg[0 : len(msg)-1])
+	if batch := batches.flush(); batch != "" {
+		if sending && c.IsRunning() {
+			c.sendBatch(batch)
+		} else {
+			c.ledger.addBatch(batch, nil)
+		}
 	}
+}
 
+// sendBatch sends a batch of bets, retrying it as the retry policy says as
+// long as it was not delivered, and adds its bets to the ledger except those
+// the server rejected. A batch whose answer was lost is not sent again, so
+// that the server does not store it twice.
+func (c *Client) sendBatch(msg string) error {
+	var ack common.BatchAck
+	err := c.retry(c.retryPolicy(), "apuesta_enviada", isUndelivered, func() error {
+		var err_sending error
+		ack, err_sending = c.SendBatchMessage(msg)
+		return err_sending
+	})
+	c.ledger.addBatch(msg, ack.Rejections)
+	return err
 }
 
-func (c *Client) SendBatchMessage(msg string) {
+// SendBatchMessage sends a batch of bets on a new connection and waits for
+// the server confirmation, which is returned. If the server rejects the
+// whole batch (e.g. the draw already closed) an error wrapping
+// ErrRejectedByServer is returned.
+func (c *Client) SendBatchMessage(msg string) (common.BatchAck, error) {
+	conn, closeConnection, err_connecting := c.connect()
+	if err_connecting != nil {
+		if c.IsRunning() {
+			log.Error("sending batch message", "fail", logger.F("client_id", c.config.ID), logger.F("error", err_connecting))
+		}
+		return common.BatchAck{}, err_connecting
+	}
+	defer closeConnection()
 
-	log.Infof("action: send_message_started | result: success | msg: %s", msg)
-	err_sending_msg := common.SendMessage(c.conn, msg)
+	log.Info("send_message_started", "success", logger.F("msg", msg))
+	err_sending_msg := common.SendMessage(conn, msg)
 	if err_sending_msg != nil {
-		if c.Running {
-			log.Errorf("action: send_message | result: fail | id: %s | error: %v",
-				c.config.ID,
-				err_sending_msg,
+		if c.IsRunning() {
+			log.Error("send_message", "fail",
+				logger.F("id", c.config.ID),
+				logger.F("error", err_sending_msg),
 			)
 		}
-		return
+		return common.BatchAck{}, err_sending_msg
 	}
-	log.Infof("action: apuesta_enviada | result: success | id: %s",
-		c.config.ID,
+	log.Info("apuesta_enviada", "success",
+		logger.F("id", c.config.ID),
 	)
+	betsInBatch := len(common.ParseBatch(msg))
+	c.metrics.batchesSent.Inc()
+	c.metrics.betsSent.Add(float64(betsInBatch))
+	c.metrics.batchSize.Observe(float64(betsInBatch))
 
-	receivedMessage, err_reading_msg := common.ReadMessage(c.conn)
+	receivedMessage, err_reading_msg := common.ReadReply(conn)
 	if err_reading_msg != nil {
-		if c.Running {
-			log.Errorf("action: read_message | result: fail | id: %s | error: %v",
-				c.config.ID,
-				err_reading_msg,
+		if c.IsRunning() {
+			log.Error("read_message", "fail",
+				logger.F("id", c.config.ID),
+				logger.F("error", err_reading_msg),
 			)
 		}
-		return
+		return common.BatchAck{}, err_reading_msg
 	}
 
-	if receivedMessage != fmt.Sprintf("%d apuestas almacenadas", len(strings.Split(msg, ";"))) {
-		log.Errorf("action: apuesta_enviada | result: fail | id: %s | received_message: %v",
-			c.config.ID,
-			receivedMessage,
+	if reason, isError := common.ParseErrorMessage(receivedMessage); isError {
+		log.Error("apuesta_enviada", "fail",
+			logger.F("id", c.config.ID),
+			logger.F("error", reason),
 		)
-	} else {
-		log.Infof("action: apuesta_enviada | result: success | id: %s | received_message: %v",
-			c.config.ID,
-			receivedMessage,
+		return common.BatchAck{}, serverError(reason)
+	}
+	ack, err_parsing := common.ParseBatchAck(receivedMessage)
+	if err_parsing != nil {
+		log.Error("apuesta_enviada", "fail",
+			logger.F("id", c.config.ID),
+			logger.F("received_message", receivedMessage),
+			logger.F("error", err_parsing),
 		)
+		return common.BatchAck{}, err_parsing
 	}
+	c.logBatchAck(msg, ack)
+	return ack, nil
+}
 
-	if c.conn != nil {
-		err_closing := c.conn.Close()
-		if err_closing != nil {
-			if c.Running {
-				log.Errorf("action: connection closed | result: fail | client_id: %v | signal: %v | closed resource: %v", c.config.ID, err_closing)
-			}
+// logBatchAck logs the server answer to a batch, including the reason
+// of every bet the server rejected.
+func (c *Client) logBatchAck(msg string, ack common.BatchAck) {
+	bets := common.ParseBatch(msg)
+	for _, receipt := range ack.Receipts {
+		c.logReceipt(receipt, bets)
+	}
+	c.metrics.betsRejected.Add(float64(len(ack.Rejections)))
+	for _, rejection := range ack.Rejections {
+		bet := ""
+		if rejection.Index >= 0 && rejection.Index < len(bets) {
+			bet = strings.Join(bets[rejection.Index].Fields, ",")
 		}
-		log.Infof("action: connection closed | result: success | client_id: %v ", c.config.ID)
-		c.conn = nil
+		log.Error("apuesta_rechazada", "fail",
+			logger.F("id", c.config.ID),
+			logger.F("motivo", rejection.Reason),
+			logger.F("apuesta", bet),
+		)
+	}
+
+	if ack.Stored != len(bets) {
+		log.Error("apuesta_enviada", "fail",
+			logger.F("id", c.config.ID),
+			logger.F("cantidad", ack.Stored),
+			logger.F("rechazadas", len(ack.Rejections)),
+		)
+	} else {
+		log.Info("apuesta_enviada", "success",
+			logger.F("id", c.config.ID),
+			logger.F("cantidad", ack.Stored),
+		)
 	}
 }
 
-func (c *Client) WaitForWinners() error {
-	log.Infof("action: waiting_winners | result: in_progress | client_id: %v", c.config.ID)
-	knowsWinners := false
-	i := 0
-	for !knowsWinners && c.Running {
-		err_creating_socket := c.createClientSocket()
-		if err_creating_socket != nil {
-			return err_creating_socket
-		}
-		log.Infof("action: create_socket | result: success | client_id: %v", c.config.ID)
-		msg := fmt.Sprintf("%s,%s;", c.config.ID, "Winners, please?")
-		err_sending_msg := common.SendMessage(c.conn, msg)
-		if err_sending_msg != nil {
-			return err_sending_msg
-		}
+// logReceipt logs the ticket the server assigned to a stored bet and, if a
+// receipt key is configured, whether its signature is valid.
+func (c *Client) logReceipt(receipt common.BetReceipt, bets []common.BatchEntry) {
+	var bet []string
+	if receipt.Index >= 0 && receipt.Index < len(bets) {
+		bet = bets[receipt.Index].Fields
+	}
+	if len(bet) < 6 {
+		log.Error("ticket_emitido", "fail",
+			logger.F("id", c.config.ID),
+			logger.F("ticket", receipt.BetID),
+			logger.F("error", fmt.Sprintf("unknown bet index %d", receipt.Index)),
+		)
+		return
+	}
 
-		log.Infof("action: send_message | result: success | id: %s | message: %s",
-			c.config.ID,
-			msg,
+	amount := ""
+	if len(bet) > 6 {
+		amount = bet[6]
+	}
+	if key := c.receiptKey(); key != "" && !VerifyReceipt([]byte(key), receipt, bet[0], bet[3], bet[5], amount) {
+		log.Error("ticket_emitido", "fail",
+			logger.F("id", c.config.ID),
+			logger.F("ticket", receipt.BetID),
+			logger.F("dni", bet[3]),
+			logger.F("numero", bet[5]),
+			logger.F("error", "invalid signature"),
 		)
+		return
+	}
+	log.Info("ticket_emitido", "success",
+		logger.F("id", c.config.ID),
+		logger.F("ticket", receipt.BetID),
+		logger.F("dni", bet[3]),
+		logger.F("numero", bet[5]),
+		logger.F("firma", receipt.Signature),
+	)
+}
 
-		receivedMessage, err_reading_msg := common.ReadMessage(c.conn)
-		if err_reading_msg != nil {
-			return err_reading_msg
+// WaitForWinners asks for the winners of the agency until the draw is
+// performed, waiting between requests as the polling policy says. Failed
+// requests are retried as the retry policy says, up to LoopAmount attempts
+// in a row.
+func (c *Client) WaitForWinners() error {
+	log.Info("waiting_winners", "in_progress", logger.F("client_id", c.config.ID))
+	knowsWinners := false
+	polls := newBackoff(c.pollingPolicy())
+	for !knowsWinners && c.IsRunning() {
+		receivedMessage, err_requesting := c.retryWinnersRequest("")
+		if err_requesting != nil {
+			return err_requesting
 		}
 
-		if receivedMessage == "No winners yet" {
-			log.Infof("action: winners_received | result: success | id: %s | received_message: '%v'",
-				c.config.ID,
-				receivedMessage,
-			)
-		} else {
+		if receivedMessage != common.NoWinnersYet {
 			knowsWinners = true
-			log.Infof("action: winners_received | result: success | id: %s | received_message: '%v'",
-				c.config.ID,
-				receivedMessage,
-			)
-			var number_winners int
-			if receivedMessage != "" {
-				number_winners = len(strings.Split(receivedMessage, ";"))
-			} else {
-				number_winners = 0
+			winners, err_collecting := c.collectWinners(receivedMessage)
+			if err_collecting != nil {
+				return err_collecting
+			}
+			var total_payout int64
+			for _, winner := range winners {
+				total_payout += winner.Payout
+				log.Info("ganador", "success",
+					logger.F("id", c.config.ID),
+					logger.F("dni", winner.Document),
+					logger.F("premio", common.FormatAmount(winner.Payout)),
+				)
 			}
 
-			log.Infof("action: consulta_ganadores | result: success | cant_ganadores: %d | id: %s ",
-				number_winners,
-				c.config.ID,
+			log.Info("consulta_ganadores", "success",
+				logger.F("cant_ganadores", len(winners)),
+				logger.F("premio_total", common.FormatAmount(total_payout)),
+				logger.F("id", c.config.ID),
 			)
 		}
-		if c.conn != nil {
-			err_closing := c.conn.Close()
-			if err_closing != nil && c.Running {
-				log.Errorf("action: connection closed | result: fail | client_id: %v | signal: %v | closed resource: %v", c.config.ID, err_closing)
-			}
-			log.Infof("action: connection closed | result: success | client_id: %v", c.config.ID)
-			c.conn = nil
+		if !knowsWinners && c.IsRunning() {
+			wait, _ := polls.next()
+			log.Info("waiting_winners sleep", "in_progress", logger.F("client_id", c.config.ID), logger.F("wait", wait))
+			c.sleep(wait)
 		}
-		if !knowsWinners && c.Running {
-			log.Infof("action: waiting_winners sleep | result: in_progress | client_id: %v", c.config.ID)
-			i++
-			time.Sleep(time.Duration(i) * time.Second)
+	}
+	return nil
+}
+
+// collectWinners reassembles the winners of the agency starting from the
+// first page received, asking for the following pages until the server
+// answers with no continuation token.
+func (c *Client) collectWinners(firstPage string) ([]common.Winner, error) {
+	page, err_parsing := common.ParseWinnersPage(firstPage)
+	if err_parsing != nil {
+		return nil, err_parsing
+	}
+	winners := page.Winners
+	for page.Next != "" && c.IsRunning() {
+		receivedMessage, err_requesting := c.retryWinnersRequest(page.Next)
+		if err_requesting != nil {
+			return nil, err_requesting
+		}
+		page, err_parsing = common.ParseWinnersPage(receivedMessage)
+		if err_parsing != nil {
+			return nil, err_parsing
 		}
+		winners = append(winners, page.Winners...)
+	}
+	return winners, nil
+}
+
+// retryWinnersRequest calls requestWinners, retrying it as the winners
+// retry policy says.
+func (c *Client) retryWinnersRequest(token string) (string, error) {
+	var receivedMessage string
+	err := c.retry(c.winnersRetryPolicy(), "consulta_ganadores", isRetryable, func() (err error) {
+		receivedMessage, err = c.requestWinners(token)
+		return err
+	})
+	return receivedMessage, err
+}
+
+// requestWinners sends a winners request on a new connection and returns
+// the answer of the server. A non-empty token asks for the page of winners
+// that starts at that continuation token.
+func (c *Client) requestWinners(token string) (string, error) {
+	msg := common.Request(c.config.ID, common.WinnersRequest)
+	if token != "" {
+		msg = common.Request(c.config.ID, common.WinnersRequest, token)
+	}
+	c.metrics.winnersQueries.Inc()
+	receivedMessage, err_requesting := c.request(msg)
+	if err_requesting != nil {
+		return "", err_requesting
+	}
+	if receivedMessage == common.NoWinnersYet {
+		c.metrics.noWinnersYet.Inc()
+	}
+	if reason, isError := common.ParseErrorMessage(receivedMessage); isError {
+		return "", serverError(reason)
+	}
+	log.Info("winners_received", "success",
+		logger.F("id", c.config.ID),
+		logger.F("received_message", receivedMessage),
+	)
+	return receivedMessage, nil
+}
+
+// CancelBet asks the server to cancel a bet previously sent by the agency,
+// identified by the bet ID received when it was stored. Bets can only be
+// cancelled until the agency starts waiting for the winners.
+func (c *Client) CancelBet(betID string) error {
+	return c.changeBet(common.Request(c.config.ID, common.CancelBetRequest, betID), common.BetCancelled)
+}
+
+// AmendBet asks the server to replace a bet previously sent by the agency
+// with the given first name, last name, document, birthdate, number and
+// stake; an empty stake amends a bet without one. Bets can only be amended
+// until the agency starts waiting for the winners.
+func (c *Client) AmendBet(betID string, firstName, lastName, document, birthdate, number, stake string) error {
+	args := []string{betID, firstName, lastName, document, birthdate, number}
+	if stake != "" {
+		args = append(args, stake)
+	}
+	return c.changeBet(common.Request(c.config.ID, common.AmendBetRequest, args...), common.BetAmended)
+}
+
+// changeBet sends a request that changes a stored bet and checks that the
+// server answers with the expected confirmation.
+func (c *Client) changeBet(msg string, confirmation string) error {
+	receivedMessage, err_requesting := c.request(msg)
+	if err_requesting != nil {
+		return err_requesting
+	}
+	if reason, isError := common.ParseErrorMessage(receivedMessage); isError {
+		log.Error("modificar_apuesta", "fail", logger.F("id", c.config.ID), logger.F("error", reason))
+		return serverError(reason)
+	}
+	if receivedMessage != confirmation {
+		return fmt.Errorf("unexpected answer from server: %q", receivedMessage)
 	}
+	log.Info("modificar_apuesta", "success", logger.F("id", c.config.ID), logger.F("received_message", receivedMessage))
 	return nil
 }
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// ErrServerBusy is returned when the server answers a request with an error
+// that is only transient, such as the agency exceeding its rate limit.
+// Unlike ErrRejectedByServer, the request can be retried later.
+var ErrServerBusy = errors.New("server busy")
+
+// ErrBetTooLarge is returned when a bet alone does not fit in a frame, so it
+// can not be sent in any batch.
+var ErrBetTooLarge = errors.New("bet exceeds the frame size limit")
+
+// dialError wraps the error of a failed attempt to connect to the server, so
+// that the request it was going to carry is known not to be delivered.
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *dialError) Unwrap() error {
+	return e.err
+}
+
+// ErrReconciliationMismatch is returned when the bets the server holds for
+// the agency are not the ones it sent.
+var ErrReconciliationMismatch = errors.New("bets do not match the server")
+
+// serverError returns the error for an error answer of the server with the
+// given reason, wrapping ErrServerBusy or ErrRejectedByServer.
+func serverError(reason string) error {
+	if common.IsRetryableError(reason) {
+		return fmt.Errorf("%w: %s", ErrServerBusy, reason)
+	}
+	return fmt.Errorf("%w: %s", ErrRejectedByServer, reason)
+}
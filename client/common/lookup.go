@@ -0,0 +1,43 @@
+package common
+
+import (
+	"errors"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// ErrDrawNotPerformed is returned by LookupBettor when the server has not
+// performed the draw yet.
+var ErrDrawNotPerformed = errors.New("draw not performed yet")
+
+// LookupBettor asks the server for the result of every bet this agency
+// stored for the given document. It can only be answered after the draw.
+func (c *Client) LookupBettor(document string) ([]common.BetResult, error) {
+	receivedMessage, err_requesting := c.request(common.Request(c.config.ID, common.LookupRequest, document))
+	if err_requesting != nil {
+		return nil, err_requesting
+	}
+	if reason, isError := common.ParseErrorMessage(receivedMessage); isError {
+		return nil, serverError(reason)
+	}
+	if receivedMessage == common.NoWinnersYet {
+		return nil, ErrDrawNotPerformed
+	}
+
+	results, err_parsing := common.ParseBetResults(receivedMessage)
+	if err_parsing != nil {
+		return nil, err_parsing
+	}
+	for _, result := range results {
+		log.Info("consulta_apostador", "success",
+			logger.F("client_id", c.config.ID),
+			logger.F("dni", document),
+			logger.F("numero", result.Number),
+			logger.F("gano", result.Won),
+			logger.F("premio", common.FormatAmount(result.Payout)),
+		)
+	}
+	log.Info("consulta_apostador", "success", logger.F("client_id", c.config.ID), logger.F("dni", document), logger.F("apuestas", len(results)))
+	return results, nil
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"net/http"
+
+	metrics "github.com/7574-sistemas-distribuidos/docker-compose-init/metrics/common"
+)
+
+// Upper bounds of the buckets of the batch size histogram, in bets.
+var batchSizeBuckets = []float64{1, 5, 10, 25, 50, 100}
+
+// clientMetrics holds the metrics the client exposes through MetricsHandler.
+type clientMetrics struct {
+	registry          *metrics.Registry
+	connectionsOpened *metrics.Counter
+	bytesReceived     *metrics.Counter
+	bytesSent         *metrics.Counter
+	batchesSent       *metrics.Counter
+	betsSent          *metrics.Counter
+	betsRejected      *metrics.Counter
+	batchSize         *metrics.Histogram
+	winnersQueries    *metrics.Counter
+	noWinnersYet      *metrics.Counter
+}
+
+func newClientMetrics() *clientMetrics {
+	registry := metrics.NewRegistry()
+	return &clientMetrics{
+		registry:          registry,
+		connectionsOpened: registry.NewCounter("agency_connections_opened_total", "Connections opened to the server."),
+		bytesReceived:     registry.NewCounter("agency_bytes_received_total", "Bytes read from the server."),
+		bytesSent:         registry.NewCounter("agency_bytes_sent_total", "Bytes written to the server."),
+		batchesSent:       registry.NewCounter("agency_batches_sent_total", "Batches of bets sent."),
+		betsSent:          registry.NewCounter("agency_bets_sent_total", "Bets sent in batches."),
+		betsRejected:      registry.NewCounter("agency_bets_rejected_total", "Bets the server rejected."),
+		batchSize:         registry.NewHistogram("agency_batch_size_bets", "Bets sent in each batch.", batchSizeBuckets),
+		winnersQueries:    registry.NewCounter("agency_winners_queries_total", "Winners requests sent."),
+		noWinnersYet:      registry.NewCounter("agency_no_winners_yet_total", "Winners requests answered with \"No winners yet\"."),
+	}
+}
+
+// MetricsHandler returns an HTTP handler that serves the metrics of the
+// client in the Prometheus text exposition format.
+func (c *Client) MetricsHandler() http.Handler {
+	return c.metrics.registry.Handler()
+}
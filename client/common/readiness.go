@@ -0,0 +1,69 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// ErrServerNotReady is returned by WaitUntilReady when the server did not
+// become ready to accept bets in time.
+var ErrServerNotReady = errors.New("server not ready")
+
+// Bounds of the wait between two readiness checks; it doubles after every
+// failed check.
+const (
+	readinessFirstWait = 100 * time.Millisecond
+	readinessMaxWait   = time.Second
+)
+
+// WaitUntilReady pings the server until it answers that it is accepting
+// bets, or until the timeout passes. If the server answers that it will not
+// accept bets anymore an error wrapping ErrRejectedByServer is returned.
+func (c *Client) WaitUntilReady(timeout time.Duration) error {
+	log.Info("esperar_servidor", "in_progress", logger.F("client_id", c.config.ID), logger.F("timeout", timeout))
+	checks := newBackoff(RetryPolicy{
+		InitialDelay: readinessFirstWait,
+		Multiplier:   2,
+		MaxDelay:     readinessMaxWait,
+		Jitter:       c.retryPolicy().Jitter,
+		Deadline:     timeout,
+	})
+	for c.IsRunning() {
+		err_ping := c.ping()
+		if err_ping == nil {
+			log.Info("esperar_servidor", "success", logger.F("client_id", c.config.ID))
+			return nil
+		}
+		if errors.Is(err_ping, ErrRejectedByServer) {
+			return err_ping
+		}
+		wait, ok := checks.next()
+		if !ok {
+			return fmt.Errorf("%w after %v: %v", ErrServerNotReady, timeout, err_ping)
+		}
+		log.Debug("esperar_servidor", "in_progress", logger.F("client_id", c.config.ID), logger.F("error", err_ping))
+		if !c.sleep(wait) {
+			break
+		}
+	}
+	return ErrServerNotReady
+}
+
+// ping sends a PingRequest and checks that the server answers Pong.
+func (c *Client) ping() error {
+	receivedMessage, err_requesting := c.request(common.Request(c.config.ID, common.PingRequest))
+	if err_requesting != nil {
+		return err_requesting
+	}
+	if reason, isError := common.ParseErrorMessage(receivedMessage); isError {
+		return serverError(reason)
+	}
+	if receivedMessage != common.Pong {
+		return fmt.Errorf("unexpected answer to ping: %q", receivedMessage)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package common
+
+import (
+	"crypto/hmac"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// VerifyReceipt checks that the receipt of a bet was signed by the server
+// with the given key. agency, document, number and amount are the fields of
+// the bet as it was sent by the agency; an empty amount is a bet without
+// stake.
+func VerifyReceipt(key []byte, receipt common.BetReceipt, agency string, document string, number string, amount string) bool {
+	cents := int64(0)
+	if amount != "" {
+		parsed, err := common.ParseAmount(amount)
+		if err != nil {
+			return false
+		}
+		cents = parsed
+	}
+	expected := common.ReceiptSignature(key, receipt.BetID, agency, document, number, cents)
+	return hmac.Equal([]byte(expected), []byte(receipt.Signature))
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// betLedger keeps track of the bets the server should hold: every bet read
+// from the bets file except those the server rejected. They are reconciled
+// against the server summary once the agency finishes, so bets that were
+// never delivered show up as a mismatch.
+type betLedger struct {
+	digest   *common.BetDigest
+	stored   int
+	rejected int
+}
+
+func newBetLedger() *betLedger {
+	return &betLedger{digest: common.NewBetDigest()}
+}
+
+// addBatch adds the bets of a batch to the ledger, except those the server
+// rejected.
+func (l *betLedger) addBatch(batch string, rejections []common.BetRejection) {
+	rejected := make(map[int]bool, len(rejections))
+	for _, rejection := range rejections {
+		rejected[rejection.Index] = true
+	}
+	for i, bet := range common.ParseBatch(batch) {
+		if !rejected[i] {
+			l.add(bet.Fields)
+		}
+	}
+	l.rejected += len(rejections)
+}
+
+// add adds a bet, given by its fields as sent in a batch, to the ledger.
+func (l *betLedger) add(fields []string) {
+	if len(fields) < 6 {
+		return
+	}
+	number, _ := strconv.Atoi(fields[5])
+	var amount int64
+	if len(fields) > 6 && fields[6] != "" {
+		amount, _ = common.ParseAmount(fields[6])
+	}
+	l.digest.Add(fields[1], fields[2], fields[3], fields[4], number, amount)
+	l.stored++
+}
+
+// Reconcile tells the server the agency finished sending its bets and checks
+// that the server holds exactly the bets of the ledger, in the same order. If
+// it does not, an error wrapping ErrReconciliationMismatch is returned.
+func (c *Client) Reconcile() error {
+	receivedMessage, err_requesting := c.request(common.Request(c.config.ID, common.FinishedRequest))
+	if err_requesting != nil {
+		return err_requesting
+	}
+	if reason, isError := common.ParseErrorMessage(receivedMessage); isError {
+		return serverError(reason)
+	}
+	summary, err_parsing := common.ParseReconciliation(receivedMessage)
+	if err_parsing != nil {
+		return err_parsing
+	}
+
+	digest := c.ledger.digest.Sum()
+	if summary.Stored != c.ledger.stored || summary.Rejected != c.ledger.rejected || summary.Digest != digest {
+		return fmt.Errorf("%w: almacenadas: %d | almacenadas_servidor: %d | rechazadas: %d | rechazadas_servidor: %d | digest: %s | digest_servidor: %s",
+			ErrReconciliationMismatch,
+			c.ledger.stored,
+			summary.Stored,
+			c.ledger.rejected,
+			summary.Rejected,
+			digest,
+			summary.Digest,
+		)
+	}
+	log.Info("conciliacion", "success",
+		logger.F("client_id", c.config.ID),
+		logger.F("almacenadas", summary.Stored),
+		logger.F("rechazadas", summary.Rejected),
+		logger.F("digest", digest),
+	)
+	return nil
+}
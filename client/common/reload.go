@@ -0,0 +1,111 @@
+package common
+
+import (
+	reload "github.com/7574-sistemas-distribuidos/docker-compose-init/reload/common"
+)
+
+// Reload applies the settings of config that can change while the client
+// runs: the batch limits, the loop settings, the receipt key and the retry
+// policy. Changes to any other setting are reported as requiring a restart.
+func (c *Client) Reload(config ClientConfig) reload.ConfigChanges {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+
+	var changes reload.ConfigChanges
+	if config.BatchMaxAmount != c.config.BatchMaxAmount {
+		c.config.BatchMaxAmount = config.BatchMaxAmount
+		changes.Applied = append(changes.Applied, "batch.maxAmount")
+	}
+	if config.BatchMaxBytes != c.config.BatchMaxBytes {
+		c.config.BatchMaxBytes = config.BatchMaxBytes
+		changes.Applied = append(changes.Applied, "batch.maxBytes")
+	}
+	if config.LoopAmount != c.config.LoopAmount {
+		c.config.LoopAmount = config.LoopAmount
+		changes.Applied = append(changes.Applied, "loop.amount")
+	}
+	if config.LoopPeriod != c.config.LoopPeriod {
+		c.config.LoopPeriod = config.LoopPeriod
+		changes.Applied = append(changes.Applied, "loop.period")
+	}
+	if config.ReceiptKey != c.config.ReceiptKey {
+		c.config.ReceiptKey = config.ReceiptKey
+		changes.Applied = append(changes.Applied, "receipt.key")
+	}
+	retrySettings := []struct {
+		name    string
+		changed bool
+	}{
+		{"retry.initialDelay", config.Retry.InitialDelay != c.config.Retry.InitialDelay},
+		{"retry.multiplier", config.Retry.Multiplier != c.config.Retry.Multiplier},
+		{"retry.maxDelay", config.Retry.MaxDelay != c.config.Retry.MaxDelay},
+		{"retry.jitter", config.Retry.Jitter != c.config.Retry.Jitter},
+		{"retry.maxAttempts", config.Retry.MaxAttempts != c.config.Retry.MaxAttempts},
+		{"retry.deadline", config.Retry.Deadline != c.config.Retry.Deadline},
+	}
+	for _, setting := range retrySettings {
+		if setting.changed {
+			changes.Applied = append(changes.Applied, setting.name)
+		}
+	}
+	c.config.Retry = config.Retry
+
+	if config.ID != c.config.ID {
+		changes.RestartRequired = append(changes.RestartRequired, "id")
+	}
+	if config.ServerAddress != c.config.ServerAddress {
+		changes.RestartRequired = append(changes.RestartRequired, "server.address")
+	}
+	if config.ReadinessTimeout != c.config.ReadinessTimeout {
+		changes.RestartRequired = append(changes.RestartRequired, "readiness.timeout")
+	}
+	if config.DataFile != c.config.DataFile {
+		changes.RestartRequired = append(changes.RestartRequired, "data.file")
+	}
+	return changes
+}
+
+// batchLimits returns the maximum amount of bets sent in each batch and the
+// maximum size of its frame.
+func (c *Client) batchLimits() (int, int) {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	return c.config.BatchMaxAmount, c.config.BatchMaxBytes
+}
+
+// retryPolicy returns the policy failed requests are retried with.
+func (c *Client) retryPolicy() RetryPolicy {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	return c.config.Retry
+}
+
+// winnersRetryPolicy returns the policy failed winners requests are retried
+// with: the retry policy, up to LoopAmount attempts.
+func (c *Client) winnersRetryPolicy() RetryPolicy {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	policy := c.config.Retry
+	policy.MaxAttempts = c.config.LoopAmount
+	return policy
+}
+
+// pollingPolicy returns the policy the winners are asked for with while the
+// draw was not performed: the first wait is LoopPeriod and it grows as the
+// retry policy says, for as long as the draw takes.
+func (c *Client) pollingPolicy() RetryPolicy {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	policy := c.config.Retry
+	policy.InitialDelay = c.config.LoopPeriod
+	policy.MaxAttempts = 0
+	policy.Deadline = 0
+	return policy
+}
+
+// receiptKey returns the key the receipts of the server are verified with.
+func (c *Client) receiptKey() string {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	return c.config.ReceiptKey
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// RetryPolicy decides how an operation that failed with a transient error is
+// retried. The wait before the n-th retry is InitialDelay * Multiplier^(n-1),
+// capped at MaxDelay and spread by up to ±Jitter of its value so that the
+// agencies do not retry in lockstep. The operation is given up after
+// MaxAttempts attempts, or once the next retry would start after Deadline
+// has passed since the first attempt; a zero value disables either limit.
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	Jitter       float64
+	MaxAttempts  int
+	Deadline     time.Duration
+}
+
+// Defaults used for the settings of the retry policy that are not set.
+const (
+	DefaultRetryInitialDelay = 100 * time.Millisecond
+	DefaultRetryMultiplier   = 2
+	DefaultRetryMaxDelay     = 5 * time.Second
+)
+
+// Delay returns how long to wait before the given retry, counting from 1.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	delay := p.InitialDelay
+	if delay <= 0 {
+		delay = DefaultRetryInitialDelay
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = DefaultRetryMultiplier
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+
+	wait := float64(delay)
+	for i := 1; i < retry && wait < float64(maxDelay); i++ {
+		wait *= multiplier
+	}
+	if wait > float64(maxDelay) {
+		wait = float64(maxDelay)
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		wait += wait * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(wait)
+}
+
+// backoff tracks the attempts of an operation retried under a policy.
+type backoff struct {
+	policy   RetryPolicy
+	started  time.Time
+	attempts int
+}
+
+func newBackoff(policy RetryPolicy) *backoff {
+	return &backoff{policy: policy, started: time.Now(), attempts: 1}
+}
+
+// next returns the wait before the next attempt, or false if the policy
+// says the operation must be given up.
+func (b *backoff) next() (time.Duration, bool) {
+	if b.policy.MaxAttempts > 0 && b.attempts >= b.policy.MaxAttempts {
+		return 0, false
+	}
+	wait := b.policy.Delay(b.attempts)
+	if b.policy.Deadline > 0 && time.Since(b.started)+wait > b.policy.Deadline {
+		return 0, false
+	}
+	b.attempts++
+	return wait, true
+}
+
+// isRetryable tells whether an operation that failed with err may succeed if
+// attempted again: the server was busy, could not be reached or closed the
+// connection. Rejections and malformed answers are final.
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrServerBusy) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isUndelivered tells whether a request that failed with err surely did not
+// reach the server: the client could not connect, or the server answered it
+// was busy without handling it. Requests that change the state of the
+// server, such as batches, are only retried in that case, since retrying
+// one the server may have handled would apply it twice.
+func isUndelivered(err error) bool {
+	var errDialing *dialError
+	return errors.Is(err, ErrServerBusy) || errors.As(err, &errDialing)
+}
+
+// retry runs operation until it succeeds, fails with an error for which
+// retryable is false, the policy gives it up or the client is stopped,
+// waiting between attempts as the policy says. The last error is returned.
+func (c *Client) retry(policy RetryPolicy, action string, retryable func(error) bool, operation func() error) error {
+	attempts := newBackoff(policy)
+	for {
+		err := operation()
+		if err == nil || !retryable(err) || !c.IsRunning() {
+			return err
+		}
+		wait, ok := attempts.next()
+		if !ok {
+			return err
+		}
+		log.Info(action, "retry", logger.F("client_id", c.config.ID), logger.F("attempt", attempts.attempts), logger.F("wait", wait), logger.F("error", err))
+		if !c.sleep(wait) {
+			return err
+		}
+	}
+}
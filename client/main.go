@@ -2,21 +2,29 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/op/go-logging"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 
 	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+	reload "github.com/7574-sistemas-distribuidos/docker-compose-init/reload/common"
 )
 
-var log = logging.MustGetLogger("log")
+var log = logger.New()
+
+// configPath is the file the configuration is read from, and reloaded from
+// on SIGHUP or whenever it changes.
+const configPath = "./config.yaml"
 
 // InitConfig Function that uses viper library to parse configuration parameters.
 // Viper is configured to read variables from both environment variables and the
@@ -37,16 +45,28 @@ func InitConfig() (*viper.Viper, error) {
 	// Add env variables supported
 	v.BindEnv("id")
 	v.BindEnv("batch", "maxAmount")
+	v.BindEnv("batch.maxBytes")
 	v.BindEnv("server", "address")
 	v.BindEnv("loop", "period")
 	v.BindEnv("loop", "amount")
 	v.BindEnv("log", "level")
+	v.BindEnv("log", "format")
+	v.BindEnv("receipt.key")
+	v.BindEnv("metrics.address")
+	v.BindEnv("readiness.timeout")
+	v.BindEnv("data.file")
+	v.BindEnv("retry.initialDelay")
+	v.BindEnv("retry.multiplier")
+	v.BindEnv("retry.maxDelay")
+	v.BindEnv("retry.jitter")
+	v.BindEnv("retry.maxAttempts")
+	v.BindEnv("retry.deadline")
 
 	// Try to read configuration from config file. If config file
 	// does not exists then ReadInConfig will fail but configuration
 	// can be loaded from the environment variables so we shouldn't
 	// return an error in that case
-	v.SetConfigFile("./config.yaml")
+	v.SetConfigFile(configPath)
 	if err := v.ReadInConfig(); err != nil {
 		fmt.Printf("Configuration could not be read from config file. Using env variables instead")
 	}
@@ -57,41 +77,51 @@ func InitConfig() (*viper.Viper, error) {
 		return nil, errors.Wrapf(err, "Could not parse CLI_LOOP_PERIOD env var as time.Duration.")
 	}
 
-	return v, nil
-}
+	if _, err := logger.ParseFormat(v.GetString("log.format")); err != nil {
+		return nil, errors.Wrapf(err, "Could not parse CLI_LOG_FORMAT env var.")
+	}
 
-// InitLogger Receives the log level to be set in go-logging as a string. This method
-// parses the string and set the level to the logger. If the level string is not
-// valid an error is returned
-func InitLogger(logLevel string) error {
-	baseBackend := logging.NewLogBackend(os.Stdout, "", 0)
-	format := logging.MustStringFormatter(
-		`%{time:2006-01-02 15:04:05} %{level:.5s}     %{message}`,
-	)
-	backendFormatter := logging.NewBackendFormatter(baseBackend, format)
+	for _, key := range []string{"readiness.timeout", "retry.initialDelay", "retry.maxDelay", "retry.deadline"} {
+		if value := v.GetString(key); value != "" {
+			if _, err := time.ParseDuration(value); err != nil {
+				return nil, errors.Wrapf(err, "Could not parse %s env var as time.Duration.", envName(key))
+			}
+		}
+	}
 
-	backendLeveled := logging.AddModuleLevel(backendFormatter)
-	logLevelCode, err := logging.LogLevel(logLevel)
-	if err != nil {
-		return err
+	for _, key := range []string{"retry.multiplier", "retry.jitter"} {
+		if value := v.GetString(key); value != "" {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return nil, errors.Wrapf(err, "Could not parse %s env var as a number.", envName(key))
+			}
+		}
 	}
-	backendLeveled.SetLevel(logLevelCode, "")
+	if jitter := v.GetFloat64("retry.jitter"); jitter < 0 || jitter > 1 {
+		return nil, errors.Errorf("CLI_RETRY_JITTER must be between 0 and 1, got %v", jitter)
+	}
+
+	return v, nil
+}
 
-	// Set the backends to be used.
-	logging.SetBackend(backendLeveled)
-	return nil
+// envName returns the env var a configuration key is read from.
+func envName(key string) string {
+	return "CLI_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
 }
 
 // PrintConfig Print all the configuration parameters of the program.
 // For debugging purposes only
 func PrintConfig(v *viper.Viper) {
-	log.Infof("action: config | result: success | client_id: %s | server_address: %s | loop_amount: %v | loop_period: %v | log_level: %s | batch_maxAmount: %v",
-		v.GetString("id"),
-		v.GetString("server.address"),
-		v.GetInt("loop.amount"),
-		v.GetDuration("loop.period"),
-		v.GetString("log.level"),
-		getMaxAmount(v),
+	log.Info("config", "success",
+		logger.F("client_id", v.GetString("id")),
+		logger.F("server_address", v.GetString("server.address")),
+		logger.F("loop_amount", v.GetInt("loop.amount")),
+		logger.F("loop_period", v.GetDuration("loop.period")),
+		logger.F("log_level", v.GetString("log.level")),
+		logger.F("log_format", v.GetString("log.format")),
+		logger.F("batch_maxAmount", getMaxAmount(v)),
+		logger.F("batch_maxBytes", getMaxBytes(v)),
+		logger.F("readiness_timeout", v.GetDuration("readiness.timeout")),
+		logger.F("retry", fmt.Sprintf("%+v", getRetryPolicy(v))),
 	)
 }
 
@@ -101,59 +131,169 @@ func main() {
 		log.Criticalf("%s", err)
 	}
 
-	if err := InitLogger(v.GetString("log.level")); err != nil {
+	if err := logger.Init(v.GetString("log.level"), v.GetString("log.format")); err != nil {
 		log.Criticalf("%s", err)
 	}
 
 	// Print program config with debugging purposes
 	PrintConfig(v)
 
-	clientConfig := common.ClientConfig{
-		ServerAddress:  v.GetString("server.address"),
-		ID:             v.GetString("id"),
-		LoopAmount:     v.GetInt("loop.amount"),
-		LoopPeriod:     v.GetDuration("loop.period"),
-		BatchMaxAmount: getMaxAmount(v),
+	client := common.NewClient(getClientConfig(v))
+	metricsServer := startMetricsServer(v.GetString("metrics.address"), client)
+	if metricsServer != nil {
+		defer metricsServer.Close()
+	}
+
+	// `client lookup <documento>` consulta el resultado de un apostador
+	// en lugar de enviar las apuestas de la agencia
+	if len(os.Args) > 1 && os.Args[1] == "lookup" {
+		if len(os.Args) != 3 {
+			log.Critical("consulta_apostador", "fail", logger.F("error", "usage: client lookup <document>"))
+			os.Exit(1)
+		}
+		if _, err := client.LookupBettor(os.Args[2]); err != nil {
+			log.Critical("consulta_apostador", "fail", logger.F("client_id", v.GetString("id")), logger.F("error", err))
+			os.Exit(1)
+		}
+		return
 	}
 
-	client := common.NewClient(clientConfig)
 	//lanza un proceso en segundo plano que espera las signals y las maneja sin bloquear la ejecución del client.
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	finishChan := make(chan bool)
-	go HandleSignals(client, &wg, finishChan)
+	go HandleSignals(client, v, &wg, finishChan)
 	client.StartClientLoop()
-	if client.Running {
-		finishChan <- true
-	}
 	close(finishChan)
 	wg.Wait()
-	log.Infof("action: client_finished | result: success | client_id: %s", v.GetString("id"))
+	log.Info("client_finished", "success", logger.F("client_id", v.GetString("id")))
 	time.Sleep(1000 * time.Millisecond)
 }
 
-func HandleSignals(c *common.Client, wg *sync.WaitGroup, finishChan chan bool) {
+// HandleSignals stops the client on SIGTERM or SIGINT and reloads its
+// configuration on SIGHUP or when the config file changes, until finishChan
+// is closed. v is the configuration the client was started with.
+func HandleSignals(c *common.Client, v *viper.Viper, wg *sync.WaitGroup, finishChan chan bool) {
 	defer wg.Done()
 	sigChannel := make(chan os.Signal, 1) // espera las signals
 	//crea un canal (chan) en Go que puede recibir valores del tipo os.Signal
 	//el 1 en make(chan os.Signal, 1) significa que es un canal con buffer de tamaño 1
-	signal.Notify(sigChannel, syscall.SIGTERM)
-	//escuche la señal SIGTERM del sistema operativo.
-	select {
-	case <-finishChan:
-		log.Infof("action: signal | result: success | signal: finish")
-	case <-sigChannel:
-		log.Infof("action: signal | result: success | signal: SIGTERM")
-		//cuando SIGTERM ocurra, se enviará automáticamente al canal sigChannel
-		//bloquea la ejecución hasta que el canal reciba la señal sigterm.
-		c.StopClient()
+	signal.Notify(sigChannel, syscall.SIGTERM, syscall.SIGINT)
+	//escuche las señales SIGTERM y SIGINT del sistema operativo.
+	reloadChannel := make(chan os.Signal, 1)
+	signal.Notify(reloadChannel, syscall.SIGHUP)
+	configChanged := reload.WatchFile(configPath)
+	for {
+		select {
+		case <-finishChan:
+			log.Info("signal", "success", logger.F("signal", "finish"))
+			return
+		case <-reloadChannel:
+			log.Info("signal", "success", logger.F("signal", "SIGHUP"))
+			v = reloadConfig(c, v)
+		case <-configChanged:
+			v = reloadConfig(c, v)
+		case sig := <-sigChannel:
+			log.Info("signal", "success", logger.F("signal", reload.SignalName(sig)))
+			//cuando SIGTERM ocurra, se enviará automáticamente al canal sigChannel
+			//bloquea la ejecución hasta que el canal reciba la señal sigterm.
+			c.Stop()
+			return
+		}
+	}
+}
+
+// reloadConfig reads the configuration again and applies to the client the
+// settings that can change at runtime, logging which ones changed. Returns
+// the configuration in use afterwards.
+func reloadConfig(c *common.Client, current *viper.Viper) *viper.Viper {
+	v, err := InitConfig()
+	if err != nil {
+		log.Error("reload_config", "fail", logger.F("error", err))
+		return current
+	}
+	if err := logger.Init(v.GetString("log.level"), v.GetString("log.format")); err != nil {
+		log.Error("reload_config", "fail", logger.F("error", err))
+		return current
+	}
+	changes := c.Reload(getClientConfig(v))
+	for _, key := range []string{"log.level", "log.format"} {
+		if v.GetString(key) != current.GetString(key) {
+			changes.Applied = append(changes.Applied, key)
+		}
+	}
+	if v.GetString("metrics.address") != current.GetString("metrics.address") {
+		changes.RestartRequired = append(changes.RestartRequired, "metrics.address")
+	}
+	log.Info("reload_config", "success",
+		logger.F("client_id", v.GetString("id")),
+		logger.F("applied", changes.Applied),
+		logger.F("restart_required", changes.RestartRequired),
+	)
+	return v
+}
+
+// startMetricsServer serves the metrics of the client on the given address
+// in the background. Returns nil if the address is empty, which disables it.
+func startMetricsServer(addr string, client *common.Client) *http.Server {
+	if addr == "" {
+		return nil
+	}
+	metricsServer := &http.Server{Addr: addr, Handler: client.MetricsHandler()}
+	go func() {
+		log.Info("metrics", "in_progress", logger.F("address", addr))
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("metrics", "fail", logger.F("error", err))
+		}
+	}()
+	return metricsServer
+}
+
+// getClientConfig builds the configuration of the client from v.
+func getClientConfig(v *viper.Viper) common.ClientConfig {
+	return common.ClientConfig{
+		ServerAddress:    v.GetString("server.address"),
+		ID:               v.GetString("id"),
+		LoopAmount:       v.GetInt("loop.amount"),
+		LoopPeriod:       v.GetDuration("loop.period"),
+		BatchMaxAmount:   getMaxAmount(v),
+		BatchMaxBytes:    getMaxBytes(v),
+		ReceiptKey:       v.GetString("receipt.key"),
+		ReadinessTimeout: v.GetDuration("readiness.timeout"),
+		DataFile:         v.GetString("data.file"),
+		Retry:            getRetryPolicy(v),
+	}
+}
+
+// getRetryPolicy builds the policy failed requests are retried with from the
+// retry section of v.
+func getRetryPolicy(v *viper.Viper) common.RetryPolicy {
+	return common.RetryPolicy{
+		InitialDelay: v.GetDuration("retry.initialDelay"),
+		Multiplier:   v.GetFloat64("retry.multiplier"),
+		MaxDelay:     v.GetDuration("retry.maxDelay"),
+		Jitter:       v.GetFloat64("retry.jitter"),
+		MaxAttempts:  v.GetInt("retry.maxAttempts"),
+		Deadline:     v.GetDuration("retry.deadline"),
 	}
 }
 
+// getMaxAmount returns the maximum amount of bets per batch, 100 if it is not
+// set. The frame size limit bounds the batches too, so it is not capped.
 func getMaxAmount(v *viper.Viper) int {
 	value := v.GetInt("batch.maxAmount")
-	if value <= 0 || value > 100 {
+	if value <= 0 {
 		return 100
 	}
 	return value
 }
+
+// getMaxBytes returns the maximum size of the frame of a batch, which can
+// not exceed the frame size limit of the protocol.
+func getMaxBytes(v *viper.Viper) int {
+	value := v.GetInt("batch.maxBytes")
+	if value <= 0 || value > protocol.MaxFrameSize {
+		return protocol.MaxFrameSize
+	}
+	return value
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// ackBatch answers every batch as fully stored.
+func ackBatch(int) string {
+	return protocol.BatchAck{}.Encode()
+}
+
+// TestBatchesCutByFrameSize tests that a batch is cut once the next bet
+// would make its frame exceed the limit, before reaching the max amount.
+func TestBatchesCutByFrameSize(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: ackBatch})
+	// every encoded bet is 42 bytes long: two of them fit in a 100 bytes
+	// frame, three do not
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		BatchMaxBytes:  100,
+		DataFile:       writeDataFile(t, testBet, testBet, testBet, testBet, testBet),
+	})
+
+	client.SendBatchMessages()
+	batches := requests.messages()
+	if len(batches) != 3 {
+		t.Fatalf("Expected the 5 bets to be sent in 3 batches, got %q", batches)
+	}
+	for i, expected := range []int{2, 2, 1} {
+		if got := len(protocol.ParseBatch(batches[i])); got != expected {
+			t.Errorf("Expected batch %d to hold %d bets, got %d", i, expected, got)
+		}
+		if size := protocol.FrameSize(len(batches[i])); size > 100 {
+			t.Errorf("Expected the frame of batch %d to be at most 100 bytes, got %d", i, size)
+		}
+	}
+}
+
+// TestBatchLimitsReloadedWhileSending tests that lowering the max amount
+// while the bets are being sent applies to the following batches.
+func TestBatchLimitsReloadedWhileSending(t *testing.T) {
+	var client *common.Client
+	addr, requests := serve(t, fakeServer{answer: func(n int) string {
+		if n == 1 {
+			client.Reload(common.ClientConfig{BatchMaxAmount: 1})
+		}
+		return protocol.BatchAck{}.Encode()
+	}})
+	client = common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 2,
+		DataFile:       writeDataFile(t, testBet, testBet, testBet, testBet, testBet, testBet),
+	})
+
+	client.SendBatchMessages()
+	batches := requests.messages()
+	if len(batches) != 5 {
+		t.Fatalf("Expected a batch of 2 bets and 4 of 1, got %q", batches)
+	}
+	for i, expected := range []int{2, 1, 1, 1, 1} {
+		if got := len(protocol.ParseBatch(batches[i])); got != expected {
+			t.Errorf("Expected batch %d to hold %d bets, got %d", i, expected, got)
+		}
+	}
+}
+
+// TestBatchesCutByMaxAmount tests that the max amount of bets still cuts
+// the batches when their frame is below the limit.
+func TestBatchesCutByMaxAmount(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: ackBatch})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 2,
+		DataFile:       writeDataFile(t, testBet, testBet, testBet),
+	})
+
+	client.SendBatchMessages()
+	if got := requests.total(); got != 2 {
+		t.Errorf("Expected the 3 bets to be sent in 2 batches, got %d", got)
+	}
+}
+
+// TestBetLargerThanFrameIsSkipped tests that a bet that alone exceeds the
+// frame limit is not sent, while the rest are.
+func TestBetLargerThanFrameIsSkipped(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: ackBatch})
+	largeBet := strings.Repeat("a", 200) + ",Lorca,30904465,1999-03-17,7574"
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		BatchMaxBytes:  100,
+		DataFile:       writeDataFile(t, testBet, largeBet, testBet),
+	})
+
+	client.SendBatchMessages()
+	batches := requests.messages()
+	if len(batches) != 1 {
+		t.Fatalf("Expected a single batch, got %q", batches)
+	}
+	if strings.Contains(batches[0], largeBet) {
+		t.Errorf("Expected the large bet not to be sent, got %q", batches[0])
+	}
+	if got := len(protocol.ParseBatch(batches[0])); got != 2 {
+		t.Errorf("Expected the other 2 bets to be sent, got %d", got)
+	}
+}
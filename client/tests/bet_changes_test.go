@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// TestAmendBetSendsStake tests that an amendment carries the stake of the
+// bet only when it has one.
+func TestAmendBetSendsStake(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: func(int) string { return protocol.BetAmended }})
+	client := common.NewClient(common.ClientConfig{ID: "1", ServerAddress: addr})
+
+	if err := client.AmendBet("0123456789abcdef", "Santiago", "Lorca", "30904465", "1999-03-17", "7574", "150.50"); err != nil {
+		t.Fatalf("Expected the bet to be amended, got %v", err)
+	}
+	if err := client.AmendBet("0123456789abcdef", "Santiago", "Lorca", "30904465", "1999-03-17", "7574", ""); err != nil {
+		t.Fatalf("Expected the bet to be amended, got %v", err)
+	}
+
+	expected := []string{
+		protocol.Request("1", protocol.AmendBetRequest, "0123456789abcdef", "Santiago", "Lorca", "30904465", "1999-03-17", "7574", "150.50"),
+		protocol.Request("1", protocol.AmendBetRequest, "0123456789abcdef", "Santiago", "Lorca", "30904465", "1999-03-17", "7574"),
+	}
+	received := requests.messages()
+	if len(received) != len(expected) {
+		t.Fatalf("Expected %d requests, got %v", len(expected), received)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Errorf("Expected request %q, got %q", expected[i], received[i])
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// sentBets returns the fields of every bet the server received, in order.
+func sentBets(t *testing.T, requests *requestCounter) [][]string {
+	t.Helper()
+	var bets [][]string
+	for _, batch := range requests.messages() {
+		for _, entry := range protocol.ParseBatch(batch) {
+			if entry.Err != nil {
+				t.Fatalf("Error parsing batch %q: %v", batch, entry.Err)
+			}
+			bets = append(bets, entry.Fields)
+		}
+	}
+	return bets
+}
+
+// TestBetsFileWithTrickyNames tests that the bets file is read as CSV, with
+// a BOM, a header, CRLF line endings and quoted names, and that the names
+// reach the server unchanged.
+func TestBetsFileWithTrickyNames(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: ackBatch})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		DataFile: writeDataFile(t,
+			"\ufeffnombre,apellido,documento,nacimiento,numero\r",
+			`"Ana, María","O""Neil",30904465,1999-03-17,7574`+"\r",
+			`Juan;Pablo,"Pérez`,
+			`Gómez",30904466,1999-03-18,7575,150.5`+"\r",
+		),
+	})
+
+	client.SendBatchMessages()
+	expected := [][]string{
+		{"1", "Ana, María", `O"Neil`, "30904465", "1999-03-17", "7574"},
+		{"1", "Juan;Pablo", "Pérez\nGómez", "30904466", "1999-03-18", "7575", "150.5"},
+	}
+	if got := sentBets(t, requests); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected bets %q, got %q", expected, got)
+	}
+}
+
+// TestBetsFileSkipsInvalidRows tests that rows that are not bets are skipped
+// and the rest are sent, and that a first row that is a bet is not taken for
+// a header.
+func TestBetsFileSkipsInvalidRows(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: ackBatch})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		DataFile: writeDataFile(t,
+			testBet,
+			"Santiago,Lorca,30904465",
+			`San"tiago,Lorca,30904465,1999-03-17,7574`,
+			"Ana,Gómez,30904466,1999-03-18,7575",
+		),
+	})
+
+	client.SendBatchMessages()
+	expected := [][]string{
+		{"1", "Santiago", "Lorca", "30904465", "1999-03-17", "7574"},
+		{"1", "Ana", "Gómez", "30904466", "1999-03-18", "7575"},
+	}
+	if got := sentBets(t, requests); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected bets %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+const testBet = "Santiago,Lorca,30904465,1999-03-17,7574"
+
+// fakeServer configures a stand-in for the lottery server started by serve.
+// addr is where it listens, a free address if empty, and delay how long it
+// waits before listening. answer returns the answer to the n-th request,
+// counting from 1; if nil, requests are read and the connection is closed
+// without answering, as a server that crashed, or left open if hold is set,
+// as a server that never answers.
+type fakeServer struct {
+	addr   string
+	delay  time.Duration
+	answer func(n int) string
+	hold   bool
+}
+
+// requestCounter records the requests a fake server received.
+type requestCounter struct {
+	lock     sync.Mutex
+	received []string
+	// arrived receives each request read, for the tests that wait for one
+	arrived chan string
+}
+
+func (r *requestCounter) next(msg string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.received = append(r.received, msg)
+	select {
+	case r.arrived <- msg:
+	default:
+	}
+	return len(r.received)
+}
+
+func (r *requestCounter) total() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.received)
+}
+
+func (r *requestCounter) messages() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.received...)
+}
+
+// serve starts the fake server until the test finishes. Returns the address
+// it listens on and the requests it received.
+func serve(t *testing.T, server fakeServer) (string, *requestCounter) {
+	t.Helper()
+	requests := &requestCounter{arrived: make(chan string, 10)}
+	done := make(chan struct{})
+	var lock sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		close(done)
+		lock.Lock()
+		defer lock.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	handle := func(conn net.Conn) {
+		msg, err := protocol.ReadMessage(conn)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		n := requests.next(msg)
+		if server.answer != nil {
+			protocol.SendMessage(conn, server.answer(n))
+		} else if server.hold {
+			return
+		}
+		conn.Close()
+	}
+	accept := func(listener net.Listener) {
+		go func() {
+			<-done
+			listener.Close()
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			conns = append(conns, conn)
+			lock.Unlock()
+			go handle(conn)
+		}
+	}
+
+	if server.addr == "" {
+		server.addr = "127.0.0.1:0"
+	}
+	if server.delay == 0 {
+		listener, err := net.Listen("tcp", server.addr)
+		if err != nil {
+			t.Fatalf("Error listening on %s: %v", server.addr, err)
+		}
+		go accept(listener)
+		return listener.Addr().String(), requests
+	}
+	go func() {
+		select {
+		case <-time.After(server.delay):
+		case <-done:
+			return
+		}
+		listener, err := net.Listen("tcp", server.addr)
+		if err != nil {
+			t.Errorf("Error listening on %s: %v", server.addr, err)
+			return
+		}
+		accept(listener)
+	}()
+	return server.addr, requests
+}
+
+// freeAddr returns an address on which nothing is listening.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error finding a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// writeDataFile writes the given lines as the bets file of the agency and
+// returns its path.
+func writeDataFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agency.csv")
+	content := ""
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing the data file: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// runLoop runs the client loop in the background and returns a channel that
+// is closed once it finishes.
+func runLoop(client *common.Client) <-chan struct{} {
+	finished := make(chan struct{})
+	go func() {
+		client.StartClientLoop()
+		close(finished)
+	}()
+	return finished
+}
+
+// TestStopWhileSending tests that stopping the client aborts a batch whose
+// confirmation the server never sends.
+func TestStopWhileSending(t *testing.T) {
+	addr, requests := serve(t, fakeServer{hold: true})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		LoopAmount:     1,
+		DataFile:       writeDataFile(t, "Santiago,Lorca,30904465,1999-03-17,7574"),
+	})
+	finished := runLoop(client)
+
+	select {
+	case <-requests.arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the client to send its batch")
+	}
+	client.Stop()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the loop to finish once the client is stopped")
+	}
+	if client.IsRunning() {
+		t.Errorf("Expected the client not to be running after Stop")
+	}
+}
+
+// TestStopWhileWaiting tests that stopping the client interrupts the wait
+// between winners requests instead of sleeping it through.
+func TestStopWhileWaiting(t *testing.T) {
+	addr, _ := serve(t, fakeServer{answer: func(int) string { return protocol.NoWinnersYet }})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		LoopAmount:     1,
+		DataFile:       writeDataFile(t),
+	})
+	finished := runLoop(client)
+
+	time.Sleep(300 * time.Millisecond)
+	stoppedAt := time.Now()
+	client.Stop()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the loop to finish once the client is stopped")
+	}
+	if elapsed := time.Since(stoppedAt); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the wait to be interrupted, the loop took %v to finish", elapsed)
+	}
+}
+
+// TestStopBeforeStart tests that a client stopped before its loop starts
+// does not contact the server at all.
+func TestStopBeforeStart(t *testing.T) {
+	addr, requests := serve(t, fakeServer{hold: true})
+	client := common.NewClient(common.ClientConfig{
+		ID:               "1",
+		ServerAddress:    addr,
+		BatchMaxAmount:   10,
+		LoopAmount:       1,
+		ReadinessTimeout: time.Second,
+		DataFile:         writeDataFile(t, "Santiago,Lorca,30904465,1999-03-17,7574"),
+	})
+	client.Stop()
+
+	select {
+	case <-runLoop(client):
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the loop of a stopped client to finish right away")
+	}
+	select {
+	case msg := <-requests.arrived:
+		t.Errorf("Expected no request from a stopped client, got %q", msg)
+	default:
+	}
+}
+
+// TestConcurrentStop tests that Stop and IsRunning can be called from many
+// goroutines at once, as the signal handler does while the loop runs.
+func TestConcurrentStop(t *testing.T) {
+	client := common.NewClient(common.ClientConfig{ID: "1", ServerAddress: freeAddr(t)})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			client.Stop()
+		}()
+		go func() {
+			defer wg.Done()
+			client.IsRunning()
+		}()
+	}
+	wg.Wait()
+
+	if client.IsRunning() {
+		t.Errorf("Expected the client not to be running after Stop")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// TestWaitUntilReadyWaitsForTheServer tests that the client keeps pinging
+// until the server starts listening and answers Pong.
+func TestWaitUntilReadyWaitsForTheServer(t *testing.T) {
+	addr, _ := serve(t, fakeServer{addr: freeAddr(t), delay: 300 * time.Millisecond, answer: func(int) string { return protocol.Pong }})
+	client := common.NewClient(common.ClientConfig{ID: "1", ServerAddress: addr})
+
+	if err := client.WaitUntilReady(5 * time.Second); err != nil {
+		t.Errorf("Expected the client to find the server ready, got %v", err)
+	}
+}
+
+// TestWaitUntilReadyTimesOut tests that the client gives up once the timeout
+// passes without the server listening.
+func TestWaitUntilReadyTimesOut(t *testing.T) {
+	client := common.NewClient(common.ClientConfig{ID: "1", ServerAddress: freeAddr(t)})
+
+	start := time.Now()
+	err := client.WaitUntilReady(500 * time.Millisecond)
+	if !errors.Is(err, common.ErrServerNotReady) {
+		t.Errorf("Expected ErrServerNotReady, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the client to give up after the timeout, waited %v", elapsed)
+	}
+}
+
+// TestWaitUntilReadyStopsWhenBetsAreClosed tests that the client stops
+// waiting if the server answers it will not accept bets.
+func TestWaitUntilReadyStopsWhenBetsAreClosed(t *testing.T) {
+	addr, _ := serve(t, fakeServer{answer: func(int) string { return protocol.ErrorMessage("draw closed, bets no longer accepted") }})
+	client := common.NewClient(common.ClientConfig{ID: "1", ServerAddress: addr})
+
+	if err := client.WaitUntilReady(5 * time.Second); !errors.Is(err, common.ErrRejectedByServer) {
+		t.Errorf("Expected ErrRejectedByServer, got %v", err)
+	}
+}
+
+// TestWaitUntilReadyRetriesWhileBusy tests that a transient error, such as
+// the rate limit of the agency, is retried instead of ending the wait.
+func TestWaitUntilReadyRetriesWhileBusy(t *testing.T) {
+	addr, _ := serve(t, fakeServer{answer: func(int) string { return protocol.ErrorMessage(protocol.ReasonRateLimited) }})
+	client := common.NewClient(common.ClientConfig{ID: "1", ServerAddress: addr})
+
+	err := client.WaitUntilReady(300 * time.Millisecond)
+	if !errors.Is(err, common.ErrServerNotReady) {
+		t.Errorf("Expected the wait to time out while the server is busy, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// TestVerifyReceiptDetectsTamperedTickets tests that a receipt only verifies
+// with the key and bet fields it was signed for.
+func TestVerifyReceiptDetectsTamperedTickets(t *testing.T) {
+	key := []byte("secret")
+	receipt := protocol.BetReceipt{
+		Index:     0,
+		BetID:     "0123456789abcdef",
+		Signature: protocol.ReceiptSignature(key, "0123456789abcdef", "1", "10000000", "7574", 15050),
+	}
+
+	if !common.VerifyReceipt(key, receipt, "1", "10000000", "7574", "150.5") {
+		t.Errorf("Expected receipt to be valid")
+	}
+	if common.VerifyReceipt(key, receipt, "1", "10000000", "7575", "150.5") {
+		t.Errorf("Expected receipt with another number to be invalid")
+	}
+	if common.VerifyReceipt(key, receipt, "1", "10000000", "7574", "1500.5") {
+		t.Errorf("Expected receipt with another stake to be invalid")
+	}
+	if common.VerifyReceipt(key, receipt, "1", "10000000", "7574", "") {
+		t.Errorf("Expected receipt without stake to be invalid")
+	}
+	if common.VerifyReceipt([]byte("other"), receipt, "1", "10000000", "7574", "150.5") {
+		t.Errorf("Expected receipt checked with another key to be invalid")
+	}
+	receipt.BetID = "fedcba9876543210"
+	if common.VerifyReceipt(key, receipt, "1", "10000000", "7574", "150.5") {
+		t.Errorf("Expected receipt with another ticket ID to be invalid")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+const otherBet = "Ana,Diaz,30904466,2001-05-02,1234"
+
+// digestOf returns the digest of the given bets of testBet and otherBet.
+func digestOf(bets ...string) string {
+	digest := protocol.NewBetDigest()
+	for _, bet := range bets {
+		switch bet {
+		case testBet:
+			digest.Add("Santiago", "Lorca", "30904465", "1999-03-17", 7574, 0)
+		case otherBet:
+			digest.Add("Ana", "Diaz", "30904466", "2001-05-02", 1234, 0)
+		}
+	}
+	return digest.Sum()
+}
+
+// sendAndReconcile sends the bets of dataFile in a single batch to a server
+// that answers it with batchAnswer and the finished request with summary,
+// and returns the result of reconciling.
+func sendAndReconcile(t *testing.T, dataFile string, batchAnswer string, summary protocol.Reconciliation) error {
+	t.Helper()
+	addr, _ := serve(t, fakeServer{answer: func(n int) string {
+		if n == 1 {
+			return batchAnswer
+		}
+		return summary.Encode()
+	}})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		DataFile:       dataFile,
+		Retry:          common.RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxAttempts: 1},
+	})
+	client.SendBatchMessages()
+	return client.Reconcile()
+}
+
+// TestReconcileMatchesStoredBets tests that reconciling succeeds when the
+// server holds every bet of the file.
+func TestReconcileMatchesStoredBets(t *testing.T) {
+	err := sendAndReconcile(t,
+		writeDataFile(t, testBet, otherBet),
+		protocol.BatchAck{Stored: 2}.Encode(),
+		protocol.Reconciliation{Stored: 2, Digest: digestOf(testBet, otherBet)},
+	)
+	if err != nil {
+		t.Errorf("Expected the bets to match, got %v", err)
+	}
+}
+
+// TestReconcileSkipsRejectedBets tests that the bets the server rejected by
+// index are not expected to be stored.
+func TestReconcileSkipsRejectedBets(t *testing.T) {
+	err := sendAndReconcile(t,
+		writeDataFile(t, testBet, otherBet),
+		protocol.BatchAck{Stored: 1, Rejections: []protocol.BetRejection{{Index: 0, Reason: "invalid bet"}}}.Encode(),
+		protocol.Reconciliation{Stored: 1, Rejected: 1, Digest: digestOf(otherBet)},
+	)
+	if err != nil {
+		t.Errorf("Expected the bets to match, got %v", err)
+	}
+}
+
+// TestReconcileDetectsUndeliveredBatch tests that a batch given up after
+// its retries makes reconciling fail.
+func TestReconcileDetectsUndeliveredBatch(t *testing.T) {
+	err := sendAndReconcile(t,
+		writeDataFile(t, testBet, otherBet),
+		protocol.ErrorMessage(protocol.ReasonShuttingDown),
+		protocol.Reconciliation{Digest: digestOf()},
+	)
+	if !errors.Is(err, common.ErrReconciliationMismatch) {
+		t.Errorf("Expected a reconciliation mismatch, got %v", err)
+	}
+}
+
+// TestReconcileDetectsRejectedBatch tests that a batch the server rejected
+// as a whole makes reconciling fail.
+func TestReconcileDetectsRejectedBatch(t *testing.T) {
+	err := sendAndReconcile(t,
+		writeDataFile(t, testBet, otherBet),
+		protocol.ErrorMessage("draw closed, bets no longer accepted"),
+		protocol.Reconciliation{Digest: digestOf()},
+	)
+	if !errors.Is(err, common.ErrReconciliationMismatch) {
+		t.Errorf("Expected a reconciliation mismatch, got %v", err)
+	}
+}
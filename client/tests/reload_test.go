@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+)
+
+// TestReloadReportsChanges tests that the settings that can change at
+// runtime are applied and the rest are reported as requiring a restart.
+func TestReloadReportsChanges(t *testing.T) {
+	config := common.ClientConfig{ID: "1", ServerAddress: "server:12345", BatchMaxAmount: 10, LoopPeriod: time.Second}
+	client := common.NewClient(config)
+
+	config.BatchMaxAmount = 50
+	config.LoopPeriod = 2 * time.Second
+	config.ServerAddress = "other:12345"
+	changes := client.Reload(config)
+	if !reflect.DeepEqual(changes.Applied, []string{"batch.maxAmount", "loop.period"}) {
+		t.Errorf("Expected batch.maxAmount and loop.period to be applied, got %v", changes.Applied)
+	}
+	if !reflect.DeepEqual(changes.RestartRequired, []string{"server.address"}) {
+		t.Errorf("Expected server.address to require a restart, got %v", changes.RestartRequired)
+	}
+
+	if changes := client.Reload(config); len(changes.Applied) != 0 {
+		t.Errorf("Expected nothing to be applied twice, got %v", changes.Applied)
+	}
+}
+
+// TestReloadAppliesRetryPolicy tests that the retry policy can change while
+// the client runs.
+func TestReloadAppliesRetryPolicy(t *testing.T) {
+	config := common.ClientConfig{ID: "1", Retry: common.RetryPolicy{InitialDelay: time.Second, MaxAttempts: 3}}
+	client := common.NewClient(config)
+
+	config.Retry.MaxAttempts = 5
+	config.Retry.Jitter = 0.1
+	changes := client.Reload(config)
+	if !reflect.DeepEqual(changes.Applied, []string{"retry.jitter", "retry.maxAttempts"}) {
+		t.Errorf("Expected retry.jitter and retry.maxAttempts to be applied, got %v", changes.Applied)
+	}
+	if len(changes.RestartRequired) != 0 {
+		t.Errorf("Expected no setting to require a restart, got %v", changes.RestartRequired)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// TestRetryPolicyDelay tests that the wait between retries grows by the
+// multiplier up to the max delay.
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := common.RetryPolicy{InitialDelay: 100 * time.Millisecond, Multiplier: 2, MaxDelay: time.Second}
+
+	expected := map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		20: time.Second,
+	}
+	for retry, delay := range expected {
+		if got := policy.Delay(retry); got != delay {
+			t.Errorf("Expected retry %d to wait %v, got %v", retry, delay, got)
+		}
+	}
+}
+
+// TestRetryPolicyJitter tests that the jitter spreads the wait within its
+// bounds.
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := common.RetryPolicy{InitialDelay: 100 * time.Millisecond, Multiplier: 2, MaxDelay: time.Second, Jitter: 0.5}
+
+	distinct := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1)
+		if delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Fatalf("Expected the wait to be within 50%% of 100ms, got %v", delay)
+		}
+		distinct[delay] = true
+	}
+	if len(distinct) < 2 {
+		t.Errorf("Expected the jitter to spread the waits, got %v", distinct)
+	}
+}
+
+// TestBatchRetriedWhileBusy tests that a batch the server answers busy to is
+// sent again until the server stores it.
+func TestBatchRetriedWhileBusy(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: func(n int) string {
+		if n < 3 {
+			return protocol.ErrorMessage(protocol.ReasonRateLimited)
+		}
+		return protocol.BatchAck{Stored: 1}.Encode()
+	}})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		DataFile:       writeDataFile(t, testBet),
+		Retry:          common.RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxAttempts: 5},
+	})
+
+	client.SendBatchMessages()
+	if got := requests.total(); got != 3 {
+		t.Errorf("Expected the batch to be sent 3 times, got %d", got)
+	}
+}
+
+// TestBatchGivenUpAfterMaxAttempts tests that a batch is given up once it
+// was attempted as many times as the policy allows, and the following
+// batches are not sent.
+func TestBatchGivenUpAfterMaxAttempts(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: func(int) string {
+		return protocol.ErrorMessage(protocol.ReasonShuttingDown)
+	}})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 1,
+		DataFile:       writeDataFile(t, testBet, testBet),
+		Retry:          common.RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxAttempts: 3},
+	})
+
+	client.SendBatchMessages()
+	if got := requests.total(); got != 3 {
+		t.Errorf("Expected the first batch to be attempted 3 times and no other, got %d requests", got)
+	}
+}
+
+// TestBatchNotRetriedWhenRejected tests that a batch the server rejects is
+// not sent again.
+func TestBatchNotRetriedWhenRejected(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: func(int) string {
+		return protocol.ErrorMessage("draw closed, bets no longer accepted")
+	}})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 10,
+		DataFile:       writeDataFile(t, testBet),
+		Retry:          common.RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxAttempts: 5},
+	})
+
+	client.SendBatchMessages()
+	if got := requests.total(); got != 1 {
+		t.Errorf("Expected the batch to be sent once, got %d", got)
+	}
+}
+
+// TestBatchNotRetriedOnceDelivered tests that a batch the server read but did
+// not answer is not sent again, since the server may have stored it.
+func TestBatchNotRetriedOnceDelivered(t *testing.T) {
+	addr, requests := serve(t, fakeServer{})
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  addr,
+		BatchMaxAmount: 1,
+		DataFile:       writeDataFile(t, testBet, testBet),
+		Retry:          common.RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxAttempts: 5},
+	})
+
+	client.SendBatchMessages()
+	if got := requests.total(); got != 1 {
+		t.Errorf("Expected the first batch to be sent once and no other, got %d requests", got)
+	}
+}
+
+// TestBatchRetriedUntilDeadline tests that a batch is given up once the
+// deadline of the policy passes, even if attempts are left.
+func TestBatchRetriedUntilDeadline(t *testing.T) {
+	client := common.NewClient(common.ClientConfig{
+		ID:             "1",
+		ServerAddress:  freeAddr(t),
+		BatchMaxAmount: 10,
+		DataFile:       writeDataFile(t, testBet),
+		Retry:          common.RetryPolicy{InitialDelay: 50 * time.Millisecond, Multiplier: 1, Deadline: 300 * time.Millisecond},
+	})
+
+	start := time.Now()
+	client.SendBatchMessages()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the batch to be given up after the deadline, took %v", elapsed)
+	}
+}
+
+// TestWinnersPolledEveryLoopPeriod tests that the winners are asked for
+// every LoopPeriod while the draw was not performed.
+func TestWinnersPolledEveryLoopPeriod(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: func(int) string { return protocol.NoWinnersYet }})
+	client := common.NewClient(common.ClientConfig{
+		ID:            "1",
+		ServerAddress: addr,
+		LoopAmount:    1,
+		LoopPeriod:    50 * time.Millisecond,
+		Retry:         common.RetryPolicy{Multiplier: 1},
+	})
+
+	finished := make(chan error)
+	go func() { finished <- client.WaitForWinners() }()
+	time.Sleep(500 * time.Millisecond)
+	client.Stop()
+	if err := <-finished; err != nil {
+		t.Errorf("Expected no error while waiting for the winners, got %v", err)
+	}
+
+	if got := requests.total(); got < 5 || got > 11 {
+		t.Errorf("Expected about 10 winners requests in 500ms, got %d", got)
+	}
+}
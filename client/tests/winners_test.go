@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/client/common"
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+)
+
+// TestWinnersCollectedFromEveryPage tests that the client follows the
+// continuation tokens until the last page of winners.
+func TestWinnersCollectedFromEveryPage(t *testing.T) {
+	pages := []protocol.WinnersPage{
+		{Winners: []protocol.Winner{{Document: "10000000", Payout: 100}, {Document: "10000001", Payout: 100}}, Next: "2"},
+		{Winners: []protocol.Winner{{Document: "10000002", Payout: 100}, {Document: "10000003", Payout: 100}}, Next: "4"},
+		{Winners: []protocol.Winner{{Document: "10000004", Payout: 100}}},
+	}
+	addr, requests := serve(t, fakeServer{answer: func(n int) string {
+		if n > len(pages) {
+			return protocol.ErrorMessage("unexpected request")
+		}
+		return pages[n-1].Encode()
+	}})
+	client := common.NewClient(common.ClientConfig{ID: "1", ServerAddress: addr, LoopAmount: 1})
+
+	if err := client.WaitForWinners(); err != nil {
+		t.Fatalf("Expected the winners to be collected, got %v", err)
+	}
+	expected := []string{
+		protocol.Request("1", protocol.WinnersRequest),
+		protocol.Request("1", protocol.WinnersRequest, "2"),
+		protocol.Request("1", protocol.WinnersRequest, "4"),
+	}
+	received := requests.messages()
+	if len(received) != len(expected) {
+		t.Fatalf("Expected a request for each of the %d pages, got %q", len(expected), received)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Errorf("Expected request %q, got %q", expected[i], received[i])
+		}
+	}
+}
+
+// TestWinnersFailOnInvalidPage tests that a page that can not be parsed
+// stops collecting the winners with an error.
+func TestWinnersFailOnInvalidPage(t *testing.T) {
+	addr, requests := serve(t, fakeServer{answer: func(n int) string {
+		if n == 1 {
+			return protocol.WinnersPage{Winners: []protocol.Winner{{Document: "10000000", Payout: 100}}, Next: "1"}.Encode()
+		}
+		return "ganadores"
+	}})
+	client := common.NewClient(common.ClientConfig{
+		ID:            "1",
+		ServerAddress: addr,
+		LoopAmount:    1,
+		Retry:         common.RetryPolicy{InitialDelay: 10 * time.Millisecond},
+	})
+
+	if err := client.WaitForWinners(); err == nil {
+		t.Errorf("Expected an invalid page to fail collecting the winners")
+	}
+	if got := requests.total(); got != 2 {
+		t.Errorf("Expected 2 winners requests, got %d", got)
+	}
+}
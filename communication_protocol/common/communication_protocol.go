@@ -8,6 +8,20 @@ import (
 	"strings"
 )
 
+// tamaño máximo, en bytes, de un frame `<longitud>:<msg>` incluido su encabezado
+const MaxFrameSize = 8 * 1024
+
+// tamaño máximo, en bytes, de un frame de respuesta del servidor: la
+// respuesta a un batch lleva un comprobante por apuesta y puede superar
+// MaxFrameSize
+const MaxReplySize = 1024 * 1024
+
+// devuelve el tamaño en bytes del frame con el que se envía un mensaje de
+// msgLength bytes
+func FrameSize(msgLength int) int {
+	return len(strconv.Itoa(msgLength)) + 1 + msgLength
+}
+
 // mensaje con formato `<longitud>:<msg>` y recibe respuesta
 func SendMessage(conn net.Conn, msg string) error {
 	if conn == nil {
@@ -32,23 +46,38 @@ func SendMessage(conn net.Conn, msg string) error {
 	return nil
 }
 
-// mensaje con formato `<longitud>:<msg>`
+// mensaje con formato `<longitud>:<msg>` cuyo frame no supera MaxFrameSize
 func ReadMessage(conn net.Conn) (string, error) {
+	return readFrame(conn, MaxFrameSize)
+}
+
+// respuesta con formato `<longitud>:<msg>` cuyo frame no supera MaxReplySize
+func ReadReply(conn net.Conn) (string, error) {
+	return readFrame(conn, MaxReplySize)
+}
+
+// lee un frame `<longitud>:<msg>` rechazando, antes de reservar memoria, las
+// longitudes negativas o cuyo frame supera maxFrameSize
+func readFrame(conn net.Conn, maxFrameSize int) (string, error) {
 	if conn == nil {
 		return "", fmt.Errorf("connection is nil")
 	}
 	reader := bufio.NewReader(conn)
-	totalBytesStr, err := reader.ReadString(':')
+	// ReadSlice no acumula más que el buffer del reader si nunca llega el `:`
+	header, err := reader.ReadSlice(':')
 	if err != nil {
 		return "", err
 	}
 
 	//elimino el `:` del final
-	totalBytesStr = strings.TrimSuffix(totalBytesStr, ":")
+	totalBytesStr := strings.TrimSuffix(string(header), ":")
 	totalBytes, err := strconv.Atoi(totalBytesStr)
 	if err != nil {
 		return "", fmt.Errorf("error al convertir la longitud: %v", err)
 	}
+	if totalBytes < 0 || FrameSize(totalBytes) > maxFrameSize {
+		return "", fmt.Errorf("longitud de mensaje inválida: %d", totalBytes)
+	}
 
 	//Leer exactamente `totalLength` bytes
 	bs := make([]byte, totalBytes)
@@ -56,7 +85,7 @@ func ReadMessage(conn net.Conn) (string, error) {
 	for bytesRead < totalBytes {
 		n, err := reader.Read(bs[bytesRead:])
 		if err != nil {
-			return "", fmt.Errorf("error al leer mensaje completo: %v", err)
+			return "", fmt.Errorf("error al leer mensaje completo: %w", err)
 		}
 		bytesRead += n
 	}
@@ -65,3 +94,32 @@ func ReadMessage(conn net.Conn) (string, error) {
 
 	return receivedMsg, nil
 }
+
+// prefijo de las respuestas que informan un error al otro extremo
+const errorPrefix = "Error: "
+
+// arma una respuesta de error con formato `Error: <motivo>`
+func ErrorMessage(reason string) string {
+	return errorPrefix + reason
+}
+
+// si el mensaje es una respuesta de error devuelve el motivo y true
+func ParseErrorMessage(msg string) (string, bool) {
+	if !strings.HasPrefix(msg, errorPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(msg, errorPrefix), true
+}
+
+// motivos de error transitorios: el pedido puede reintentarse más tarde
+const (
+	// la agencia envió más mensajes de los permitidos por su límite
+	ReasonRateLimited = "rate limited, retry later"
+	// el servidor se está cerrando y no procesa mensajes nuevos
+	ReasonShuttingDown = "server shutting down"
+)
+
+// indica si el motivo de un error es transitorio y conviene reintentar
+func IsRetryableError(reason string) bool {
+	return reason == ReasonRateLimited || reason == ReasonShuttingDown
+}
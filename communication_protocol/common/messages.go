@@ -0,0 +1,425 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// formato de la primera línea de la respuesta a un batch de apuestas
+const storedBetsFormat = "%d apuestas almacenadas"
+
+// prefijo de las líneas que informan una apuesta rechazada
+const rejectedBetPrefix = "rechazada"
+
+// prefijo de las líneas que informan el ID asignado a una apuesta almacenada
+const storedBetPrefix = "apuesta"
+
+// Mensajes de una agencia: la primera línea es el tipo del mensaje y el
+// resto su cuerpo, `<tipo>\n<cuerpo>`. El tipo de un batch es BetsMessage y
+// el de un pedido es el nombre del pedido. Como el tipo va siempre en su
+// propia línea, ningún campo de una apuesta puede confundirse con un pedido.
+const BetsMessage = "Bets"
+
+// pedidos que envía una agencia, con su agencia y sus argumentos en el cuerpo
+// como un registro CSV `<agencia>[,<argumento>...]`
+const (
+	WinnersRequest   = "Winners, please?"
+	CancelBetRequest = "Cancel bet"
+	AmendBetRequest  = "Amend bet"
+	FinishedRequest  = "Bets finished"
+	LookupRequest    = "Lookup bettor"
+	PingRequest      = "Ping"
+)
+
+// respuestas del servidor a los pedidos de una agencia
+const (
+	NoWinnersYet = "No winners yet"
+	BetCancelled = "apuesta cancelada"
+	BetAmended   = "apuesta modificada"
+	// respuesta a PingRequest cuando el servidor está aceptando apuestas
+	Pong = "Pong"
+)
+
+// ParseMessage separa un mensaje de una agencia en su tipo y su cuerpo
+func ParseMessage(msg string) (string, string) {
+	separator := strings.Index(msg, "\n")
+	if separator < 0 {
+		return msg, ""
+	}
+	return msg[:separator], msg[separator+1:]
+}
+
+// encodeRecord serializa los campos como un registro CSV (RFC 4180)
+// terminado en salto de línea. Los campos con comas, comillas o saltos de
+// línea van entre comillas, por lo que pueden contener cualquier carácter.
+func encodeRecord(fields []string) string {
+	var record strings.Builder
+	writer := csv.NewWriter(&record)
+	writer.Write(fields)
+	writer.Flush()
+	return record.String()
+}
+
+// Request arma el pedido de una agencia con sus argumentos
+func Request(agency string, request string, args ...string) string {
+	return request + "\n" + encodeRecord(append([]string{agency}, args...))
+}
+
+// ParseRequest interpreta un mensaje como el pedido indicado. Devuelve la
+// agencia que lo envía, sus argumentos y false si el mensaje es de otro
+// tipo. Si el cuerpo no es un registro CSV la agencia y los argumentos
+// quedan vacíos.
+func ParseRequest(msg string, request string) (string, []string, bool) {
+	msgType, body := ParseMessage(msg)
+	if msgType != request {
+		return "", nil, false
+	}
+	reader := csv.NewReader(strings.NewReader(body))
+	reader.FieldsPerRecord = -1
+	fields, err := reader.Read()
+	if err != nil {
+		return "", nil, true
+	}
+	if len(fields) == 1 {
+		return fields[0], nil, true
+	}
+	return fields[0], fields[1:], true
+}
+
+// EncodeBet serializa una apuesta como un registro CSV terminado en salto
+// de línea, con formato
+// `<agencia>,<nombre>,<apellido>,<documento>,<nacimiento>,<numero>[,<monto>]`.
+// El cuerpo de un batch es la concatenación de sus apuestas (ver
+// BatchMessage).
+func EncodeBet(fields []string) string {
+	return encodeRecord(fields)
+}
+
+// BatchMessage arma el mensaje de un batch a partir de sus apuestas
+// serializadas con EncodeBet y concatenadas
+func BatchMessage(bets string) string {
+	return BetsMessage + "\n" + bets
+}
+
+// BatchEntry es una apuesta de un batch: sus campos, o el error de formato si
+// el registro no pudo interpretarse.
+type BatchEntry struct {
+	Fields []string
+	Err    error
+}
+
+// ParseBatch interpreta las apuestas del mensaje de un batch armado con
+// BatchMessage. Un registro mal formado no impide interpretar los siguientes.
+func ParseBatch(msg string) []BatchEntry {
+	_, body := ParseMessage(msg)
+	reader := csv.NewReader(strings.NewReader(body))
+	reader.FieldsPerRecord = -1
+	var entries []BatchEntry
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return entries
+		}
+		entries = append(entries, BatchEntry{Fields: fields, Err: err})
+	}
+}
+
+// BetRejection informa una apuesta del batch que el servidor no almacenó.
+// Index es la posición de la apuesta dentro del batch (empezando en 0).
+type BetRejection struct {
+	Index  int
+	Reason string
+}
+
+// BetReceipt es el comprobante de una apuesta almacenada: el ID de ticket que
+// le asignó el servidor y su firma (ver ReceiptSignature), vacía si el
+// servidor no tiene clave configurada.
+// Index es la posición de la apuesta dentro del batch (empezando en 0).
+type BetReceipt struct {
+	Index     int
+	BetID     string
+	Signature string
+}
+
+// ReceiptSignature calcula la firma HMAC-SHA256, en hexadecimal, del
+// comprobante de una apuesta a partir de los campos que la identifican y de
+// su monto en centavos, para que no pueda alterarse lo apostado
+func ReceiptSignature(key []byte, betID string, agency string, document string, number string, amount int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{betID, agency, document, number, FormatAmount(amount)}, "|")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BatchAck es la respuesta del servidor a un batch de apuestas. Después de
+// la primera línea cada apuesta es un registro CSV, por lo que el motivo de
+// un rechazo puede contener comas:
+//
+//	<cantidad> apuestas almacenadas
+//	apuesta,<indice>,<id>,<firma>
+//	rechazada,<indice>,<motivo>
+//	...
+type BatchAck struct {
+	Stored     int
+	Receipts   []BetReceipt
+	Rejections []BetRejection
+}
+
+// Encode serializa la respuesta para enviarla con SendMessage
+func (a BatchAck) Encode() string {
+	msg := fmt.Sprintf(storedBetsFormat, a.Stored) + "\n"
+	for _, receipt := range a.Receipts {
+		msg += encodeRecord([]string{storedBetPrefix, strconv.Itoa(receipt.Index), receipt.BetID, receipt.Signature})
+	}
+	for _, rejection := range a.Rejections {
+		msg += encodeRecord([]string{rejectedBetPrefix, strconv.Itoa(rejection.Index), rejection.Reason})
+	}
+	return msg
+}
+
+// ParseBatchAck interpreta la respuesta del servidor a un batch de apuestas
+func ParseBatchAck(msg string) (BatchAck, error) {
+	first, rest := ParseMessage(msg)
+	var ack BatchAck
+	if _, err := fmt.Sscanf(first, storedBetsFormat, &ack.Stored); err != nil {
+		return BatchAck{}, fmt.Errorf("respuesta a batch inválida: %q", first)
+	}
+	reader := csv.NewReader(strings.NewReader(rest))
+	reader.FieldsPerRecord = -1
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return ack, nil
+		}
+		if err != nil {
+			return BatchAck{}, fmt.Errorf("línea de respuesta a batch inválida: %v", err)
+		}
+		if len(fields) < 3 {
+			return BatchAck{}, fmt.Errorf("línea de respuesta a batch inválida: %q", fields)
+		}
+		index, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return BatchAck{}, fmt.Errorf("índice de apuesta inválido: %q", fields[1])
+		}
+		switch {
+		case fields[0] == storedBetPrefix && len(fields) == 4:
+			ack.Receipts = append(ack.Receipts, BetReceipt{Index: index, BetID: fields[2], Signature: fields[3]})
+		case fields[0] == rejectedBetPrefix && len(fields) == 3:
+			ack.Rejections = append(ack.Rejections, BetRejection{Index: index, Reason: fields[2]})
+		default:
+			return BatchAck{}, fmt.Errorf("línea de respuesta a batch inválida: %q", fields)
+		}
+	}
+}
+
+// Winner es un documento ganador junto con el premio que le corresponde,
+// expresado en centavos.
+type Winner struct {
+	Document string
+	Payout   int64
+}
+
+// EncodeWinners serializa la lista de ganadores de una agencia con formato
+// `<documento>:<premio>;<documento>:<premio>...`
+func EncodeWinners(winners []Winner) string {
+	entries := make([]string, 0, len(winners))
+	for _, winner := range winners {
+		entries = append(entries, fmt.Sprintf("%s:%s", winner.Document, FormatAmount(winner.Payout)))
+	}
+	return strings.Join(entries, ";")
+}
+
+// ParseWinners interpreta la lista de ganadores enviada por el servidor
+func ParseWinners(msg string) ([]Winner, error) {
+	if msg == "" {
+		return nil, nil
+	}
+	var winners []Winner
+	for _, entry := range strings.Split(msg, ";") {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("ganador inválido: %q", entry)
+		}
+		payout, err := ParseAmount(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		winners = append(winners, Winner{Document: fields[0], Payout: payout})
+	}
+	return winners, nil
+}
+
+// prefijo de la primera línea de cada página de ganadores
+const winnersPagePrefix = "ganadores"
+
+// WinnersPage es una página de la lista de ganadores de una agencia. Next es
+// el token de continuación que se envía como argumento de WinnersRequest para
+// pedir la página siguiente, vacío si es la última. Se serializa como
+//
+//	ganadores,<siguiente>
+//	<documento>:<premio>;<documento>:<premio>...
+type WinnersPage struct {
+	Winners []Winner
+	Next    string
+}
+
+// Encode serializa la página para enviarla con SendMessage
+func (p WinnersPage) Encode() string {
+	return fmt.Sprintf("%s,%s\n%s", winnersPagePrefix, p.Next, EncodeWinners(p.Winners))
+}
+
+// ParseWinnersPage interpreta una página de ganadores enviada por el servidor
+func ParseWinnersPage(msg string) (WinnersPage, error) {
+	lines := strings.SplitN(msg, "\n", 2)
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], winnersPagePrefix+",") {
+		return WinnersPage{}, fmt.Errorf("página de ganadores inválida: %q", msg)
+	}
+	winners, err := ParseWinners(lines[1])
+	if err != nil {
+		return WinnersPage{}, err
+	}
+	return WinnersPage{Winners: winners, Next: strings.TrimPrefix(lines[0], winnersPagePrefix+",")}, nil
+}
+
+// FormatAmount escribe un monto en centavos con dos decimales, ej. `150.05`
+func FormatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// ParseAmount interpreta un monto con a lo sumo dos decimales, ej. `150`,
+// `150.5` o `150.05`, y lo devuelve en centavos
+func ParseAmount(amount string) (int64, error) {
+	units, decimals := amount, ""
+	if point := strings.Index(amount, "."); point >= 0 {
+		units, decimals = amount[:point], amount[point+1:]
+	}
+	if len(decimals) > 2 || (decimals != "" && strings.TrimLeft(decimals, "0123456789") != "") {
+		return 0, fmt.Errorf("monto inválido: %q", amount)
+	}
+	whole, err := strconv.ParseInt(units, 10, 64)
+	if err != nil || whole >= math.MaxInt64/100 || whole <= math.MinInt64/100 {
+		return 0, fmt.Errorf("monto inválido: %q", amount)
+	}
+	for len(decimals) < 2 {
+		decimals += "0"
+	}
+	cents, _ := strconv.ParseInt(decimals, 10, 64)
+	if strings.HasPrefix(units, "-") {
+		return whole*100 - cents, nil
+	}
+	return whole*100 + cents, nil
+}
+
+// prefijo de la respuesta a FinishedRequest
+const reconciliationPrefix = "reconciliacion"
+
+// Reconciliation es el resumen que el servidor devuelve cuando una agencia
+// termina de enviar sus apuestas: cuántas almacenó, cuántas rechazó y el
+// digest (ver BetDigest) de las almacenadas, en orden. Se serializa como
+// `reconciliacion,<almacenadas>,<rechazadas>,<digest>`
+type Reconciliation struct {
+	Stored   int
+	Rejected int
+	Digest   string
+}
+
+// Encode serializa el resumen para enviarlo con SendMessage
+func (r Reconciliation) Encode() string {
+	return fmt.Sprintf("%s,%d,%d,%s", reconciliationPrefix, r.Stored, r.Rejected, r.Digest)
+}
+
+// ParseReconciliation interpreta la respuesta del servidor a FinishedRequest
+func ParseReconciliation(msg string) (Reconciliation, error) {
+	fields := strings.Split(msg, ",")
+	if len(fields) != 4 || fields[0] != reconciliationPrefix {
+		return Reconciliation{}, fmt.Errorf("resumen de conciliación inválido: %q", msg)
+	}
+	stored, errStored := strconv.Atoi(fields[1])
+	rejected, errRejected := strconv.Atoi(fields[2])
+	if errStored != nil || errRejected != nil {
+		return Reconciliation{}, fmt.Errorf("resumen de conciliación inválido: %q", msg)
+	}
+	return Reconciliation{Stored: stored, Rejected: rejected, Digest: fields[3]}, nil
+}
+
+// BetDigest calcula un SHA-256 sobre una secuencia de apuestas, de modo que
+// cliente y servidor obtengan el mismo valor si tienen las mismas apuestas en
+// el mismo orden. Los montos se toman en centavos.
+type BetDigest struct {
+	hash hash.Hash
+}
+
+// NewBetDigest crea un digest sin apuestas
+func NewBetDigest() *BetDigest {
+	return &BetDigest{hash: sha256.New()}
+}
+
+// Add agrega una apuesta al digest
+func (d *BetDigest) Add(firstName string, lastName string, document string, birthdate string, number int, amount int64) {
+	for _, field := range []string{firstName, lastName, document, birthdate, strconv.Itoa(number), FormatAmount(amount)} {
+		d.hash.Write([]byte(field))
+		d.hash.Write([]byte{0})
+	}
+}
+
+// Sum devuelve el digest, en hexadecimal, de las apuestas agregadas
+func (d *BetDigest) Sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// BetResult es el resultado del sorteo para una apuesta de un apostador
+type BetResult struct {
+	Number int
+	Won    bool
+	Payout int64
+}
+
+// EncodeBetResults serializa los resultados de las apuestas de un apostador
+// con formato `<numero>:<gano|perdio>:<premio>;...`
+func EncodeBetResults(results []BetResult) string {
+	entries := make([]string, 0, len(results))
+	for _, result := range results {
+		outcome := "perdio"
+		if result.Won {
+			outcome = "gano"
+		}
+		entries = append(entries, fmt.Sprintf("%d:%s:%s", result.Number, outcome, FormatAmount(result.Payout)))
+	}
+	return strings.Join(entries, ";")
+}
+
+// ParseBetResults interpreta la respuesta del servidor a LookupRequest
+func ParseBetResults(msg string) ([]BetResult, error) {
+	if msg == "" {
+		return nil, nil
+	}
+	var results []BetResult
+	for _, entry := range strings.Split(msg, ";") {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 3 || (fields[1] != "gano" && fields[1] != "perdio") {
+			return nil, fmt.Errorf("resultado inválido: %q", entry)
+		}
+		number, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("resultado inválido: %q", entry)
+		}
+		payout, err := ParseAmount(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, BetResult{Number: number, Won: fields[1] == "gano", Payout: payout})
+	}
+	return results, nil
+}
@@ -11,15 +11,23 @@ def create_file(name_file, number_of_clients):
     
     
 def server_content(number_of_clients):
+    agencies = ",".join(str(i) for i in range(1, number_of_clients+1))
     return f"""\
     server:
         container_name: server
         image: server:latest
         entrypoint: /server
         environment:
-        - SERVER_NUMBER_OF_AGENCIES={number_of_clients}
+        - SERVER_AGENCIES={agencies}
+        - SERVER_RECEIPT_KEY=tp0-receipt-key
+        - SERVER_ADMIN_ADDRESS=:8080
         networks:
         - testing_net
+        healthcheck:
+            test: ["CMD", "wget", "-q", "-O", "/dev/null", "http://localhost:8080/readyz"]
+            interval: 1s
+            timeout: 1s
+            retries: 30
         volumes:
         - ./server/config.ini:/config.ini  
     """
@@ -34,10 +42,13 @@ def clients_content(number_of_clients):
         entrypoint: /client
         environment:
         - CLI_ID={i}
+        - CLI_RECEIPT_KEY=tp0-receipt-key
+        - CLI_READINESS_TIMEOUT=30s
         networks:
         - testing_net
         depends_on:
-        - server
+            server:
+                condition: service_healthy
         volumes:
         - ./client/config.yaml:/config.yaml 
         - ./.data/agency-{i}.csv:/.data/agency-{i}.csv
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// fieldAliases maps the keys used in the log lines to the name of the JSON
+// field they are written as.
+var fieldAliases = map[string]string{
+	"id":       "client_id",
+	"cantidad": "count",
+}
+
+// recordFields returns the fields of a record: the action, result and
+// fields of an entry, or the whole message as a "msg" field for a line
+// logged with one of the free-form methods.
+func recordFields(record *logging.Record) []Field {
+	if len(record.Args) == 1 {
+		if line, ok := record.Args[0].(entry); ok {
+			fields := append([]Field{F("action", line.action), F("result", line.result)}, line.fields...)
+			for i, field := range fields {
+				if alias, ok := fieldAliases[field.Key]; ok {
+					fields[i].Key = alias
+				}
+			}
+			return fields
+		}
+	}
+	return []Field{F("msg", record.Message())}
+}
+
+// jsonValue encodes the value of a field. Errors and values with a String
+// method, such as durations, are written as their text; values that can not
+// be encoded are written as with %v.
+func jsonValue(value interface{}) []byte {
+	switch typed := value.(type) {
+	case error:
+		value = typed.Error()
+	case fmt.Stringer:
+		value = typed.String()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return encoded
+}
+
+// jsonBackend is a go-logging backend that writes every record as a JSON
+// object on its own line.
+type jsonBackend struct {
+	lock sync.Mutex
+	out  io.Writer
+}
+
+func newJSONBackend(out io.Writer) *jsonBackend {
+	return &jsonBackend{out: out}
+}
+
+// Log writes the record with its time and level followed by its fields, in
+// the order they were given.
+func (b *jsonBackend) Log(level logging.Level, calldepth int, record *logging.Record) error {
+	fields := append([]Field{
+		F("time", record.Time.Format(time.RFC3339Nano)),
+		F("level", level.String()),
+	}, recordFields(record)...)
+
+	var line bytes.Buffer
+	line.WriteByte('{')
+	seen := map[string]bool{}
+	for _, field := range fields {
+		// A repeated key would make the object ambiguous; keep the first.
+		if seen[field.Key] {
+			continue
+		}
+		seen[field.Key] = true
+		if len(seen) > 1 {
+			line.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		line.Write(key)
+		line.WriteByte(':')
+		line.Write(jsonValue(field.Value))
+	}
+	line.WriteString("}\n")
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	_, err := b.out.Write(line.Bytes())
+	return err
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/op/go-logging"
+)
+
+// Formats in which the log lines can be written.
+const (
+	// FormatText writes lines as `<time> <level> action: ... | result: ...`.
+	FormatText = "text"
+	// FormatJSON writes each line as a JSON object with typed fields.
+	FormatJSON = "json"
+)
+
+// module is the go-logging module every Logger writes to, so that Init
+// configures all of them at once.
+const module = "log"
+
+// textFormat is the layout of the lines written with FormatText.
+const textFormat = `%{time:2006-01-02 15:04:05} %{level:.5s}     %{message}`
+
+// Logger writes the `action: <action> | result: <result> | <key>: <value>`
+// lines of the binaries. How they end up written, as text or JSON, is
+// decided once by Init.
+type Logger struct {
+	logger *logging.Logger
+}
+
+// Field is a key of a log line and its value. The JSON format keeps the type
+// of the value; the text format writes it as with %v.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns the field with the given key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// entry is a line with an action, its result and the fields that describe
+// it. It is handed to go-logging as the only argument of the record: the
+// text format writes it through String, and the JSON backend reads its
+// fields.
+type entry struct {
+	action string
+	result string
+	fields []Field
+}
+
+// String writes the entry as `action: <action> | result: <result> | ...`.
+func (e entry) String() string {
+	var line strings.Builder
+	fmt.Fprintf(&line, "action: %s | result: %s", e.action, e.result)
+	for _, field := range e.fields {
+		fmt.Fprintf(&line, " | %s: %v", field.Key, field.Value)
+	}
+	return line.String()
+}
+
+// New creates a Logger. Loggers can be created before Init is called.
+func New() *Logger {
+	logger := logging.MustGetLogger(module)
+	// Skip the frame of the Logger method so that go-logging reports the caller.
+	logger.ExtraCalldepth = 1
+	return &Logger{logger: logger}
+}
+
+// ParseFormat validates the name of a log format.
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case FormatText, FormatJSON:
+		return format, nil
+	case "":
+		return FormatText, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", format)
+}
+
+// ParseLevel validates the name of a log level, such as DEBUG or INFO.
+func ParseLevel(level string) (string, error) {
+	if _, err := logging.LogLevel(level); err != nil {
+		return "", fmt.Errorf("unknown log level %q", level)
+	}
+	return strings.ToUpper(level), nil
+}
+
+// Init sets the minimum level and the format of every Logger, writing to
+// stdout. An empty format is FormatText.
+func Init(level string, format string) error {
+	return InitWriter(os.Stdout, level, format)
+}
+
+// InitWriter is like Init but writes the lines to out.
+func InitWriter(out io.Writer, level string, format string) error {
+	logLevel, err := logging.LogLevel(level)
+	if err != nil {
+		return err
+	}
+	format, err = ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	var backend logging.Backend
+	if format == FormatJSON {
+		backend = newJSONBackend(out)
+	} else {
+		backend = logging.NewBackendFormatter(logging.NewLogBackend(out, "", 0), logging.MustStringFormatter(textFormat))
+	}
+	leveled := logging.AddModuleLevel(backend)
+	leveled.SetLevel(logLevel, "")
+	logging.SetBackend(leveled)
+	return nil
+}
+
+// Debug logs the result of an action with level DEBUG.
+func (l *Logger) Debug(action string, result string, fields ...Field) {
+	l.logger.Debug(entry{action: action, result: result, fields: fields})
+}
+
+// Info logs the result of an action with level INFO.
+func (l *Logger) Info(action string, result string, fields ...Field) {
+	l.logger.Info(entry{action: action, result: result, fields: fields})
+}
+
+// Warning logs the result of an action with level WARNING.
+func (l *Logger) Warning(action string, result string, fields ...Field) {
+	l.logger.Warning(entry{action: action, result: result, fields: fields})
+}
+
+// Error logs the result of an action with level ERROR.
+func (l *Logger) Error(action string, result string, fields ...Field) {
+	l.logger.Error(entry{action: action, result: result, fields: fields})
+}
+
+// Critical logs the result of an action with level CRITICAL.
+func (l *Logger) Critical(action string, result string, fields ...Field) {
+	l.logger.Critical(entry{action: action, result: result, fields: fields})
+}
+
+// Fatal logs the result of an action with level CRITICAL and exits with
+// status 1.
+func (l *Logger) Fatal(action string, result string, fields ...Field) {
+	l.logger.Critical(entry{action: action, result: result, fields: fields})
+	os.Exit(1)
+}
+
+// Debugf logs a free-form line with level DEBUG. Lines about an action
+// should use Debug, so that the JSON format can type their fields.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf(format, args...)
+}
+
+// Infof logs a free-form line with level INFO.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logger.Infof(format, args...)
+}
+
+// Warningf logs a free-form line with level WARNING.
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.logger.Warningf(format, args...)
+}
+
+// Errorf logs a free-form line with level ERROR.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(format, args...)
+}
+
+// Criticalf logs a free-form line with level CRITICAL.
+func (l *Logger) Criticalf(format string, args ...interface{}) {
+	l.logger.Criticalf(format, args...)
+}
+
+// Fatalf logs a free-form line with level CRITICAL and exits with status 1.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.logger.Criticalf(format, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// initWriter makes every Logger write to out with the given format until
+// the test finishes.
+func initWriter(t *testing.T, out *bytes.Buffer, format string) {
+	t.Helper()
+	if err := logger.InitWriter(out, "INFO", format); err != nil {
+		t.Fatalf("Error initializing logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Init("INFO", logger.FormatText) })
+}
+
+// TestTextFormatWritesActionLines tests that with the text format the
+// action, result and fields are written as `key: value` separated by pipes.
+func TestTextFormatWritesActionLines(t *testing.T) {
+	var out bytes.Buffer
+	initWriter(t, &out, logger.FormatText)
+	log := logger.New()
+
+	log.Info("apuesta_enviada", "fail", logger.F("id", "3"), logger.F("cantidad", 12), logger.F("error", errors.New("dial tcp: refused")))
+
+	expected := "action: apuesta_enviada | result: fail | id: 3 | cantidad: 12 | error: dial tcp: refused"
+	if line := strings.TrimSpace(out.String()); !strings.HasSuffix(line, expected) {
+		t.Errorf("Expected a line ending in %q, got %q", expected, line)
+	}
+}
+
+// TestJSONFormatWritesOneObjectPerLine tests that with the JSON format every
+// line is a JSON object with the fields of the action, keeping their types.
+func TestJSONFormatWritesOneObjectPerLine(t *testing.T) {
+	var out bytes.Buffer
+	initWriter(t, &out, logger.FormatJSON)
+	log := logger.New()
+
+	log.Debug("ignorada", "success")
+	log.Info("apuesta_recibida", "success",
+		logger.F("agency", 2),
+		logger.F("cantidad", 5),
+		logger.F("id", "3"),
+		logger.F("error", errors.New("dial tcp: refused: a | b")),
+		logger.F("wait", 1500*time.Millisecond),
+	)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected a single line above the level, got %q", out.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", lines[0], err)
+	}
+	if entry["level"] != "INFO" || entry["action"] != "apuesta_recibida" || entry["result"] != "success" {
+		t.Errorf("Expected level, action and result to be kept, got %v", entry)
+	}
+	if entry["agency"] != float64(2) || entry["count"] != float64(5) {
+		t.Errorf("Expected agency and count to be numbers, got %v", entry)
+	}
+	if entry["client_id"] != "3" {
+		t.Errorf("Expected id to be written as client_id, got %v", entry)
+	}
+	if entry["error"] != "dial tcp: refused: a | b" || entry["wait"] != "1.5s" {
+		t.Errorf("Expected errors and durations to be written as text, got %v", entry)
+	}
+	if _, ok := entry["time"].(string); !ok {
+		t.Errorf("Expected the line to have a time, got %v", entry)
+	}
+}
+
+// TestJSONFormatKeepsFreeFormLines tests that a line logged without an
+// action is written whole as the msg field.
+func TestJSONFormatKeepsFreeFormLines(t *testing.T) {
+	var out bytes.Buffer
+	initWriter(t, &out, logger.FormatJSON)
+	log := logger.New()
+
+	log.Errorf("action: looks like | result: an action line")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", out.String(), err)
+	}
+	if entry["msg"] != "action: looks like | result: an action line" || entry["action"] != nil {
+		t.Errorf("Expected the line to be kept as msg, got %v", entry)
+	}
+}
+
+// TestUnknownFormatIsRejected tests that only the known formats are accepted.
+func TestUnknownFormatIsRejected(t *testing.T) {
+	if _, err := logger.ParseFormat("xml"); err == nil {
+		t.Errorf("Expected format xml to be rejected")
+	}
+}
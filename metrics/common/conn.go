@@ -0,0 +1,34 @@
+package common
+
+import "net"
+
+// countingConn is a net.Conn that adds the bytes it reads and writes to
+// a pair of counters.
+type countingConn struct {
+	net.Conn
+	received *Counter
+	sent     *Counter
+}
+
+// CountBytes wraps the connection so that every byte read is added to
+// received and every byte written is added to sent. The counters must not
+// have labels.
+func CountBytes(conn net.Conn, received *Counter, sent *Counter) net.Conn {
+	return &countingConn{Conn: conn, received: received, sent: sent}
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.received.Add(float64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.sent.Add(float64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,225 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kinds of metrics, as written in the TYPE line of the exposition format.
+const (
+	kindCounter   = "counter"
+	kindHistogram = "histogram"
+)
+
+// Registry holds a set of metrics and writes them in the Prometheus text
+// exposition format, in the order they were registered.
+// It is safe for concurrent use.
+type Registry struct {
+	lock     sync.Mutex
+	families []*family
+	names    map[string]bool
+}
+
+// family is a metric along with one series per combination of label values.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+// series holds the value of a metric for a combination of label values.
+// Counters only use value; histograms keep how many observations fell in
+// each bucket, not accumulated, plus their sum and count.
+type series struct {
+	labelValues []string
+	value       float64
+	bucketCount []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewRegistry creates a registry without metrics.
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// Counter is a metric that can only go up.
+type Counter struct {
+	registry *Registry
+	family   *family
+}
+
+// Histogram is a metric that counts observations in buckets.
+type Histogram struct {
+	registry *Registry
+	family   *family
+}
+
+// NewCounter registers a counter with the given label names. Panics if the
+// name is already registered, like registering a handler twice does.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{registry: r, family: r.register(name, help, kindCounter, nil, labels)}
+}
+
+// NewHistogram registers a histogram with the given upper bounds for its
+// buckets, in ascending order, and label names. A bucket for +Inf is always
+// added. Panics if the name is already registered.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	return &Histogram{registry: r, family: r.register(name, help, kindHistogram, buckets, labels)}
+}
+
+func (r *Registry) register(name string, help string, kind string, buckets []float64, labels []string) *family {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = true
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*series{}}
+	if len(labels) == 0 {
+		// Metrics without labels are reported even before they change.
+		f.get(nil)
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series for the label values, creating it if needed. Must
+// be called holding the registry lock.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.bucketCount = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Inc adds one to the counter for the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative amount to the counter for the label values.
+func (c *Counter) Add(amount float64, labelValues ...string) {
+	if amount < 0 {
+		panic(fmt.Sprintf("metrics: counter %s cannot decrease", c.family.name))
+	}
+	c.registry.lock.Lock()
+	defer c.registry.lock.Unlock()
+	c.family.get(labelValues).value += amount
+}
+
+// Observe records an observation of the histogram for the label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.registry.lock.Lock()
+	defer h.registry.lock.Unlock()
+	s := h.family.get(labelValues)
+	bucket := sort.SearchFloat64s(h.family.buckets, value)
+	s.bucketCount[bucket]++
+	s.sum += value
+	s.count++
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	r.lock.Lock()
+	for _, f := range r.families {
+		f.write(&b)
+	}
+	r.lock.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// write writes the family with its series sorted by label values. Must be
+// called holding the registry lock.
+func (f *family) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind == kindCounter {
+			fmt.Fprintf(b, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+		var accumulated uint64
+		for i, count := range s.bucketCount {
+			accumulated += count
+			bound := math.Inf(1)
+			if i < len(f.buckets) {
+				bound = f.buckets[i]
+			}
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "le", formatValue(bound)), accumulated)
+		}
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// formatLabels writes the label set of a series, adding the extra label if
+// its name is not empty. Returns an empty string if there are no labels.
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, escapeLabelValue(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+// Handler returns an HTTP handler that serves the metrics of the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
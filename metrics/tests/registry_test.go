@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metrics "github.com/7574-sistemas-distribuidos/docker-compose-init/metrics/common"
+)
+
+// TestRegistryWritesExpositionFormat tests that counters and histograms are
+// written in the Prometheus text exposition format.
+func TestRegistryWritesExpositionFormat(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.NewCounter("requests_total", "Requests received.")
+	rejected := registry.NewCounter("rejected_total", "Rejected \"things\".", "agency", "reason")
+	sizes := registry.NewHistogram("batch_size", "Batch sizes.", []float64{1, 10})
+
+	requests.Inc()
+	requests.Add(2)
+	rejected.Inc("2", "menor_de_edad")
+	rejected.Inc("1", `con "comillas"`)
+	sizes.Observe(1)
+	sizes.Observe(5)
+	sizes.Observe(50)
+
+	var output strings.Builder
+	if _, err := registry.WriteTo(&output); err != nil {
+		t.Fatalf("Error writing metrics: %v", err)
+	}
+	expected := `# HELP requests_total Requests received.
+# TYPE requests_total counter
+requests_total 3
+# HELP rejected_total Rejected "things".
+# TYPE rejected_total counter
+rejected_total{agency="1",reason="con \"comillas\""} 1
+rejected_total{agency="2",reason="menor_de_edad"} 1
+# HELP batch_size Batch sizes.
+# TYPE batch_size histogram
+batch_size_bucket{le="1"} 1
+batch_size_bucket{le="10"} 2
+batch_size_bucket{le="+Inf"} 3
+batch_size_sum 56
+batch_size_count 3
+`
+	if output.String() != expected {
+		t.Errorf("Expected metrics:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+// TestCountBytesCountsTraffic tests that a wrapped connection adds the bytes
+// read and written to its counters.
+func TestCountBytesCountsTraffic(t *testing.T) {
+	registry := metrics.NewRegistry()
+	received := registry.NewCounter("received_bytes_total", "Bytes received.")
+	sent := registry.NewCounter("sent_bytes_total", "Bytes sent.")
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := metrics.CountBytes(client, received, sent)
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 5)
+		server.Read(buf)
+		server.Write([]byte("hi"))
+	}()
+	conn.Write([]byte("hello"))
+	conn.Read(make([]byte, 2))
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, line := range []string{"received_bytes_total 2\n", "sent_bytes_total 5\n"} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+	"github.com/fsnotify/fsnotify"
+)
+
+var log = logger.New()
+
+// ConfigChanges lists, by their name in the config file, the settings that
+// differ between the configuration in use and a reloaded one. Applied ones
+// took effect right away; RestartRequired ones are ignored until the binary
+// is restarted.
+type ConfigChanges struct {
+	Applied         []string
+	RestartRequired []string
+}
+
+// WatchFile returns a channel that receives a value whenever the file
+// at path is written or replaced. The directory is watched rather than the
+// file so that editors that replace the file are noticed too. If the file
+// can not be watched the channel never receives, and SIGHUP is the only
+// way to reload.
+func WatchFile(path string) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error("watch_config", "fail", logger.F("error", err))
+		return changed
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		log.Error("watch_config", "fail", logger.F("error", err))
+		watcher.Close()
+		return changed
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(path) || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				// A pending reload already picks up this change.
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error("watch_config", "fail", logger.F("error", err))
+			}
+		}
+	}()
+	return changed
+}
+
+// SignalName returns the name of a termination signal, e.g. SIGTERM.
+func SignalName(sig os.Signal) string {
+	switch sig {
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	case syscall.SIGINT:
+		return "SIGINT"
+	}
+	return sig.String()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	reload "github.com/7574-sistemas-distribuidos/docker-compose-init/reload/common"
+)
+
+// TestWatchFileNoticesChanges tests that writing the watched file is
+// reported, and writing another file of its directory is not.
+func TestWatchFileNoticesChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.ini")
+	if err := os.WriteFile(path, []byte("a"), 0o644); err != nil {
+		t.Fatalf("Error writing the config file: %v", err)
+	}
+	changed := reload.WatchFile(path)
+
+	if err := os.WriteFile(filepath.Join(dir, "other.ini"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("Error writing another file: %v", err)
+	}
+	select {
+	case <-changed:
+		t.Fatalf("Expected a change to another file not to be reported")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("b"), 0o644); err != nil {
+		t.Fatalf("Error writing the config file: %v", err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the change to the config file to be reported")
+	}
+}
+
+// TestSignalName tests that the termination signals are named as in the
+// logs.
+func TestSignalName(t *testing.T) {
+	if name := reload.SignalName(syscall.SIGTERM); name != "SIGTERM" {
+		t.Errorf("Expected SIGTERM, got %q", name)
+	}
+	if name := reload.SignalName(syscall.SIGINT); name != "SIGINT" {
+		t.Errorf("Expected SIGINT, got %q", name)
+	}
+}
@@ -0,0 +1,259 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// AgencyStatus is the state of an agency reported by the admin API.
+type AgencyStatus struct {
+	Agency   int  `json:"agency"`
+	Finished bool `json:"finished"`
+	Absent   bool `json:"absent"`
+	Bets     int  `json:"bets"`
+	Rejected int  `json:"rejected"`
+}
+
+// DrawStatus is the state of the draw reported by the admin API.
+type DrawStatus struct {
+	Performed       bool  `json:"performed"`
+	Archived        bool  `json:"archived"`
+	AbsentAgencies  []int `json:"absent_agencies"`
+	AgenciesWaiting []int `json:"agencies_waiting"`
+}
+
+// WinnerStatus is a winner of an agency reported by the admin API. The
+// payout is formatted with two decimals.
+type WinnerStatus struct {
+	Document string `json:"document"`
+	Payout   string `json:"payout"`
+}
+
+// AdminHandler returns the handler of the HTTP admin API:
+//
+//	GET  /agencies              state of every registered agency
+//	POST /agencies?agency=<id>  registers an agency
+//	GET  /draw                  state of the draw
+//	POST /draw                  performs the draw right away
+//	GET  /winners?agency=<id>   winners of an agency
+//	POST /round/close           archives the results of the contest
+//	POST /drain                 stops accepting connections and lets the
+//	                            ones in progress finish
+//	GET  /connections           open client connections, only those of
+//	                            an agency if ?agency=<id> is given
+//	POST /connections/close?agency=<id>
+//	                            closes the connections of an agency
+//	GET  /metrics               metrics of the server (see MetricsHandler)
+//	GET  /healthz               liveness probe
+//	GET  /readyz                readiness probe, 503 while bets are not
+//	                            being accepted
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agencies", s.handleAdminAgencies)
+	mux.HandleFunc("/draw", s.handleAdminDraw)
+	mux.HandleFunc("/winners", s.handleAdminWinners)
+	mux.HandleFunc("/round/close", s.handleAdminCloseRound)
+	mux.HandleFunc("/drain", s.handleAdminDrain)
+	mux.HandleFunc("/connections", s.handleAdminConnections)
+	mux.HandleFunc("/connections/close", s.handleAdminCloseConnections)
+	mux.Handle("/metrics", s.MetricsHandler())
+	mux.HandleFunc("/healthz", s.handleLiveness)
+	mux.HandleFunc("/readyz", s.handleReadiness)
+	return mux
+}
+
+func (s *Server) handleAdminAgencies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		statuses, err_status := s.agencyStatuses()
+		if err_status != nil {
+			writeAdminError(w, http.StatusInternalServerError, err_status)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, statuses)
+	case http.MethodPost:
+		agency, err_agency := strconv.Atoi(r.URL.Query().Get("agency"))
+		if err_agency != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid agency %q", r.URL.Query().Get("agency")))
+			return
+		}
+		if err_registering := s.RegisterAgency(agency); err_registering != nil {
+			writeAdminError(w, http.StatusConflict, err_registering)
+			return
+		}
+		writeAdminJSON(w, http.StatusCreated, AgencyStatus{Agency: agency})
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleAdminDraw(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, http.StatusOK, s.drawStatus())
+	case http.MethodPost:
+		if err_drawing := s.PerformDraw(); err_drawing != nil {
+			writeAdminError(w, http.StatusConflict, err_drawing)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, s.drawStatus())
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleAdminWinners(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	agency, err_agency := strconv.Atoi(r.URL.Query().Get("agency"))
+	if err_agency != nil || !s.registry.IsRegistered(agency) {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("unknown agency %q", r.URL.Query().Get("agency")))
+		return
+	}
+
+	s.lockWinnerRevealed.Lock()
+	revealed, archived := s.winnerRevealed, s.archived
+	winners, tookPart := s.results[agency]
+	s.lockWinnerRevealed.Unlock()
+	switch {
+	case archived:
+		writeAdminError(w, http.StatusGone, fmt.Errorf("contest archived"))
+	case !revealed:
+		writeAdminError(w, http.StatusConflict, fmt.Errorf("draw not performed yet"))
+	case !tookPart:
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("agency %d absent from draw", agency))
+	default:
+		statuses := make([]WinnerStatus, 0, len(winners))
+		for _, winner := range winners {
+			statuses = append(statuses, WinnerStatus{Document: winner.Document, Payout: common.FormatAmount(winner.Payout)})
+		}
+		writeAdminJSON(w, http.StatusOK, statuses)
+	}
+}
+
+func (s *Server) handleAdminCloseRound(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if err_archiving := s.Archive(); err_archiving != nil {
+		writeAdminError(w, http.StatusConflict, err_archiving)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, s.drawStatus())
+}
+
+func (s *Server) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	s.Drain()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleAdminConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	connections := s.Connections()
+	if agencyParam := r.URL.Query().Get("agency"); agencyParam != "" {
+		agency, err_agency := strconv.Atoi(agencyParam)
+		if err_agency != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid agency %q", agencyParam))
+			return
+		}
+		ofAgency := []ConnectionInfo{}
+		for _, conn := range connections {
+			if conn.Agency == agency {
+				ofAgency = append(ofAgency, conn)
+			}
+		}
+		connections = ofAgency
+	}
+	writeAdminJSON(w, http.StatusOK, connections)
+}
+
+func (s *Server) handleAdminCloseConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	agency, err_agency := strconv.Atoi(r.URL.Query().Get("agency"))
+	if err_agency != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid agency %q", r.URL.Query().Get("agency")))
+		return
+	}
+	closed := s.CloseAgencyConnections(agency)
+	if closed == nil {
+		closed = []ConnectionInfo{}
+	}
+	writeAdminJSON(w, http.StatusOK, closed)
+}
+
+// agencyStatuses returns the state of every registered agency, counting the
+// bets stored for each one.
+func (s *Server) agencyStatuses() ([]AgencyStatus, error) {
+	s.betsLock.Lock()
+	bets, err_loading_bets := LoadBets()
+	s.betsLock.Unlock()
+	if err_loading_bets != nil && !os.IsNotExist(err_loading_bets) {
+		return nil, err_loading_bets
+	}
+	betsPerAgency := map[int]int{}
+	for _, bet := range bets {
+		betsPerAgency[bet.Agency]++
+	}
+
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+	statuses := []AgencyStatus{}
+	for _, agency := range s.registry.Agencies() {
+		statuses = append(statuses, AgencyStatus{
+			Agency:   agency,
+			Finished: s.registry.HasFinished(agency),
+			Absent:   s.absentAgencies[agency],
+			Bets:     betsPerAgency[agency],
+			Rejected: s.rejectedBets[agency],
+		})
+	}
+	return statuses, nil
+}
+
+// drawStatus returns the state of the draw.
+func (s *Server) drawStatus() DrawStatus {
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	return DrawStatus{
+		Performed:       s.winnerRevealed,
+		Archived:        s.archived,
+		AbsentAgencies:  sortedKeys(s.absentAgencies),
+		AgenciesWaiting: sortedKeys(s.agenciesWaiting),
+	}
+}
+
+// writeAdminJSON answers an admin API request with the value as JSON.
+func writeAdminJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err_encoding := json.NewEncoder(w).Encode(value); err_encoding != nil {
+		log.Error("admin_api", "fail", logger.F("error", err_encoding))
+	}
+}
+
+// writeAdminError answers an admin API request with the error as JSON.
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	log.Error("admin_api", "fail", logger.F("status", status), logger.F("error", err))
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,152 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// handleCancelBetMessage cancels a bet previously stored by the agency.
+// The request has the bet ID as its only argument.
+func (s *Server) handleCancelBetMessage(clientConn net.Conn, agencyStr string, args []string) {
+	if len(args) != 1 {
+		s.sendError(clientConn, "invalid cancel request")
+		return
+	}
+	agency, err_agency := s.registeredAgency(agencyStr)
+	if err_agency != nil {
+		s.sendError(clientConn, err_agency.Error())
+		return
+	}
+
+	betID := args[0]
+	err_cancelling := s.changeBet(agency, betID, func(stored Bet) error {
+		if err := StoreBetCancellation(stored); err != nil {
+			return err
+		}
+		delete(s.betsByID, betID)
+		s.duplicates.Forget(stored)
+		return nil
+	})
+	if err_cancelling != nil {
+		log.Error("cancelar_apuesta", "fail", logger.F("agency", agency), logger.F("bet_id", betID), logger.F("error", err_cancelling))
+		s.sendError(clientConn, err_cancelling.Error())
+		return
+	}
+	log.Info("cancelar_apuesta", "success", logger.F("agency", agency), logger.F("bet_id", betID))
+	s.sendReply(clientConn, common.BetCancelled)
+}
+
+// handleAmendBetMessage replaces a bet previously stored by the agency. The
+// request arguments are the bet ID followed by the new first name, last name,
+// document, birthdate, number and, optionally, stake.
+func (s *Server) handleAmendBetMessage(clientConn net.Conn, agencyStr string, args []string) {
+	if len(args) != 6 && len(args) != 7 {
+		s.sendError(clientConn, "invalid amend request")
+		return
+	}
+	agency, err_agency := s.registeredAgency(agencyStr)
+	if err_agency != nil {
+		s.sendError(clientConn, err_agency.Error())
+		return
+	}
+
+	betID := args[0]
+	amended, err_creating_bet := NewBet(agencyStr, args[1], args[2], args[3], args[4], args[5])
+	if err_creating_bet == nil && len(args) == 7 {
+		amended.Amount, err_creating_bet = parseStake(args[6])
+	}
+	if err_creating_bet != nil {
+		s.sendError(clientConn, ReasonInvalidFormat)
+		return
+	}
+	if err_validating := ValidateBet(amended, s.currentValidationRules()); err_validating != nil {
+		log.Error("modificar_apuesta", "fail", logger.F("agency", agency), logger.F("bet_id", betID), logger.F("error", err_validating))
+		s.sendError(clientConn, validationReason(err_validating))
+		return
+	}
+	amended.ID = betID
+
+	// The amended bet replaces the stored one, so it is only a duplicate of
+	// the other bets.
+	err_amending := s.changeBet(agency, betID, func(stored Bet) error {
+		s.duplicates.Forget(stored)
+		err := s.checkDuplicate(amended)
+		if err == nil {
+			err = StoreBetAmendment(amended)
+		}
+		if err != nil {
+			s.duplicates.Record([]Bet{stored})
+			return err
+		}
+		s.betsByID[betID] = amended
+		s.duplicates.Record([]Bet{amended})
+		return nil
+	})
+	if err_amending != nil {
+		log.Error("modificar_apuesta", "fail", logger.F("agency", agency), logger.F("bet_id", betID), logger.F("error", err_amending))
+		s.sendError(clientConn, err_amending.Error())
+		return
+	}
+	log.Info("modificar_apuesta", "success", logger.F("agency", agency), logger.F("bet_id", betID))
+	s.sendReply(clientConn, common.BetAmended)
+}
+
+// checkDuplicate applies the duplicate policy to a single bet, as done for
+// the bets of a batch. Returns an error with the reason if the policy
+// rejects it.
+func (s *Server) checkDuplicate(bet Bet) error {
+	policy := s.currentDuplicatePolicy()
+	if policy == DuplicatePolicyAccept {
+		return nil
+	}
+	reason := s.duplicates.Find(bet, nil)
+	if reason == "" {
+		return nil
+	}
+	if policy == DuplicatePolicyReject {
+		return errors.New(reason)
+	}
+	log.Warning("apuesta_marcada", "success", logger.F("agency", bet.Agency), logger.F("documento", bet.Document), logger.F("motivo", reason))
+	s.duplicates.Flag(bet, reason)
+	return nil
+}
+
+// changeBet looks up a bet of the agency and calls apply with it. Bets can
+// only be changed until the agency finishes and before the draw, so apply
+// runs holding both the draw and the bets locks.
+func (s *Server) changeBet(agency int, betID string, apply func(stored Bet) error) error {
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	if s.winnerRevealed {
+		return fmt.Errorf("draw closed, bets can no longer be changed")
+	}
+	if s.registry.HasFinished(agency) {
+		return fmt.Errorf("agency %d already finished", agency)
+	}
+
+	s.betsLock.Lock()
+	defer s.betsLock.Unlock()
+	stored, found := s.betsByID[betID]
+	if !found || stored.Agency != agency {
+		return fmt.Errorf("unknown bet %s", betID)
+	}
+	return apply(stored)
+}
+
+// registeredAgency parses the agency that sent a request and checks
+// that it is registered.
+func (s *Server) registeredAgency(agencyStr string) (int, error) {
+	agency, err := strconv.Atoi(agencyStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid agency %q", agencyStr)
+	}
+	if !s.registry.IsRegistered(agency) {
+		return 0, fmt.Errorf("unknown agency %d", agency)
+	}
+	return agency, nil
+}
@@ -0,0 +1,241 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Defaults of the values that are usually read from config.ini.
+const (
+	DefaultPort          = 12345
+	DefaultListenBacklog = 5
+	DefaultLogLevel      = "INFO"
+	// DefaultShutdownTimeout is below the 10 seconds docker waits after
+	// SIGTERM before killing the container.
+	DefaultShutdownTimeout = 5 * time.Second
+)
+
+// LoadConfig reads the configuration of the server from the config.ini file
+// at path and from the environment, which takes precedence over the file.
+// The keys of the DEFAULT section can be overridden with env vars of the
+// same name (e.g. SERVER_PORT, LOGGING_LEVEL); every other value is read
+// from SERVER_* env vars. A missing file is not an error. The returned
+// configuration is validated.
+func LoadConfig(path string) (ServerConfig, error) {
+	v := viper.New()
+	v.AutomaticEnv()
+
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	v.SetEnvPrefix("server")
+	v.BindEnv("number_of_agencies")
+	v.BindEnv("agencies")
+	v.BindEnv("draw_deadline")
+	v.BindEnv("min_age")
+	v.SetDefault("min_age", 18)
+	v.BindEnv("duplicate_policy")
+	v.SetDefault("duplicate_policy", DuplicatePolicyFlag)
+	v.BindEnv("receipt_key")
+	v.BindEnv("house_percentage")
+	v.BindEnv("prize_tiers")
+	v.SetDefault("prize_tiers", "100")
+	v.BindEnv("winners_page_size")
+	v.SetDefault("winners_page_size", DefaultWinnersPageSize)
+	v.BindEnv("lifecycle_policy")
+	v.SetDefault("lifecycle_policy", LifecyclePolicyExit)
+	v.BindEnv("results_grace_period")
+	v.BindEnv("max_connections")
+	v.BindEnv("rate_limit")
+	v.BindEnv("rate_burst")
+	v.BindEnv("shutdown_timeout")
+	v.SetDefault("shutdown_timeout", DefaultShutdownTimeout.String())
+	v.BindEnv("admin_address")
+	v.BindEnv("metrics_address")
+	v.BindEnv("log_format")
+	// The keys of config.ini keep their name as env vars; the prefixed
+	// names are still accepted for compatibility.
+	v.BindEnv("default.server_port", "SERVER_PORT", "SERVER_DEFAULT_SERVER_PORT")
+	v.SetDefault("default.server_port", DefaultPort)
+	v.BindEnv("default.server_ip", "SERVER_IP", "SERVER_DEFAULT_SERVER_IP")
+	v.BindEnv("default.server_listen_backlog", "SERVER_LISTEN_BACKLOG", "SERVER_DEFAULT_SERVER_LISTEN_BACKLOG")
+	v.SetDefault("default.server_listen_backlog", DefaultListenBacklog)
+	v.BindEnv("default.logging_level", "LOGGING_LEVEL", "SERVER_DEFAULT_LOGGING_LEVEL")
+	v.SetDefault("default.logging_level", DefaultLogLevel)
+
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		log.Warning("config", "fail", logger.F("error", err), logger.F("msg", "using env variables instead"))
+	}
+
+	var config ServerConfig
+	var err error
+	if config.Port, err = getInt(v, "default.server_port", "SERVER_PORT"); err != nil {
+		return ServerConfig{}, err
+	}
+	if config.ListenBacklog, err = getInt(v, "default.server_listen_backlog", "SERVER_LISTEN_BACKLOG"); err != nil {
+		return ServerConfig{}, err
+	}
+	config.IP = v.GetString("default.server_ip")
+	config.LogLevel = v.GetString("default.logging_level")
+	config.LogFormat = v.GetString("log_format")
+
+	if config.Agencies, err = ParseAgencies(v.GetString("agencies")); err != nil {
+		return ServerConfig{}, errors.Wrapf(err, "Could not parse SERVER_AGENCIES env var as a list of agency ids.")
+	}
+	if len(config.Agencies) == 0 {
+		agencies, err := getInt(v, "number_of_agencies", "SERVER_NUMBER_OF_AGENCIES")
+		if err != nil {
+			return ServerConfig{}, err
+		}
+		for agency := 1; agency <= agencies; agency++ {
+			config.Agencies = append(config.Agencies, agency)
+		}
+	}
+	if config.DrawDeadline, err = getDuration(v, "draw_deadline", "SERVER_DRAW_DEADLINE"); err != nil {
+		return ServerConfig{}, err
+	}
+	if config.MinAge, err = getInt(v, "min_age", "SERVER_MIN_AGE"); err != nil {
+		return ServerConfig{}, err
+	}
+	config.DuplicatePolicy = v.GetString("duplicate_policy")
+	config.ReceiptKey = v.GetString("receipt_key")
+
+	splits, err := ParseTierSplits(v.GetString("prize_tiers"))
+	if err != nil {
+		return ServerConfig{}, errors.Wrapf(err, "Could not parse SERVER_PRIZE_TIERS env var.")
+	}
+	housePercentage, err := getInt(v, "house_percentage", "SERVER_HOUSE_PERCENTAGE")
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	config.PrizeRules = PrizeRules{HousePercentage: housePercentage, TierSplits: splits}
+
+	if config.WinnersPageSize, err = getInt(v, "winners_page_size", "SERVER_WINNERS_PAGE_SIZE"); err != nil {
+		return ServerConfig{}, err
+	}
+	if config.WinnersPageSize <= 0 {
+		return ServerConfig{}, errors.Errorf("SERVER_WINNERS_PAGE_SIZE must be positive")
+	}
+	config.LifecyclePolicy = v.GetString("lifecycle_policy")
+	if config.ResultsGracePeriod, err = getDuration(v, "results_grace_period", "SERVER_RESULTS_GRACE_PERIOD"); err != nil {
+		return ServerConfig{}, err
+	}
+	if config.LifecyclePolicy == LifecyclePolicyGracePeriod && config.ResultsGracePeriod == 0 {
+		return ServerConfig{}, errors.Errorf("SERVER_RESULTS_GRACE_PERIOD must be set when SERVER_LIFECYCLE_POLICY is %s", LifecyclePolicyGracePeriod)
+	}
+	if config.MaxConnections, err = getInt(v, "max_connections", "SERVER_MAX_CONNECTIONS"); err != nil {
+		return ServerConfig{}, err
+	}
+	if rateLimit := strings.TrimSpace(v.GetString("rate_limit")); rateLimit != "" {
+		if config.RateLimit, err = strconv.ParseFloat(rateLimit, 64); err != nil {
+			return ServerConfig{}, errors.Wrapf(err, "Could not parse SERVER_RATE_LIMIT env var as a number.")
+		}
+	}
+	if config.RateBurst, err = getInt(v, "rate_burst", "SERVER_RATE_BURST"); err != nil {
+		return ServerConfig{}, err
+	}
+	if config.ShutdownTimeout, err = getDuration(v, "shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT"); err != nil {
+		return ServerConfig{}, err
+	}
+	config.AdminAddress = v.GetString("admin_address")
+	config.MetricsAddress = v.GetString("metrics_address")
+
+	if err := config.Validate(); err != nil {
+		return ServerConfig{}, errors.Wrapf(err, "Invalid server configuration")
+	}
+	return config, nil
+}
+
+// Validate checks that every value of the configuration is valid. Zero
+// values are valid and stand for the defaults documented in ServerConfig.
+func (c ServerConfig) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port %d out of range", c.Port)
+	}
+	if c.ListenBacklog < 0 {
+		return fmt.Errorf("listen backlog must not be negative, got %d", c.ListenBacklog)
+	}
+	if c.LogLevel != "" {
+		if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+	if _, err := logger.ParseFormat(c.LogFormat); err != nil {
+		return err
+	}
+	if c.DrawDeadline < 0 {
+		return fmt.Errorf("draw deadline must not be negative, got %v", c.DrawDeadline)
+	}
+	if c.MinAge < 0 {
+		return fmt.Errorf("min age must not be negative, got %d", c.MinAge)
+	}
+	if c.DuplicatePolicy != "" {
+		if _, err := ParseDuplicatePolicy(c.DuplicatePolicy); err != nil {
+			return err
+		}
+	}
+	if len(c.PrizeRules.TierSplits) > 0 {
+		if err := c.PrizeRules.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.WinnersPageSize < 0 {
+		return fmt.Errorf("winners page size must not be negative, got %d", c.WinnersPageSize)
+	}
+	if c.LifecyclePolicy != "" {
+		if _, err := ParseLifecyclePolicy(c.LifecyclePolicy); err != nil {
+			return err
+		}
+	}
+	if c.MaxConnections < 0 {
+		return fmt.Errorf("max connections must not be negative, got %d", c.MaxConnections)
+	}
+	if c.RateLimit < 0 || math.IsNaN(c.RateLimit) || math.IsInf(c.RateLimit, 0) {
+		return fmt.Errorf("rate limit must be a non negative number, got %v", c.RateLimit)
+	}
+	if c.RateBurst < 0 {
+		return fmt.Errorf("rate burst must not be negative, got %d", c.RateBurst)
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout must not be negative, got %v", c.ShutdownTimeout)
+	}
+	if c.ResultsGracePeriod < 0 {
+		return fmt.Errorf("results grace period must not be negative, got %v", c.ResultsGracePeriod)
+	}
+	return nil
+}
+
+// getInt returns the value of the key as an integer, with an error naming
+// the env var if it is not one.
+func getInt(v *viper.Viper, key string, envVar string) (int, error) {
+	value := strings.TrimSpace(v.GetString(key))
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not parse %s env var as an integer.", envVar)
+	}
+	return number, nil
+}
+
+// getDuration returns the value of the key as a time.Duration, with an
+// error naming the env var if it is not one.
+func getDuration(v *viper.Viper, key string, envVar string) (time.Duration, error) {
+	value := v.GetString(key)
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not parse %s env var as time.Duration.", envVar)
+	}
+	return duration, nil
+}
@@ -0,0 +1,169 @@
+package common
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operations a connection can be performing, as reported by ConnectionInfo.
+const (
+	OperationReading   = "reading"
+	OperationStoreBets = "store_bets"
+	OperationFinished  = "finished"
+	OperationWinners   = "winners"
+	OperationPing      = "ping"
+	OperationLookup    = "lookup"
+	OperationCancelBet = "cancel_bet"
+	OperationAmendBet  = "amend_bet"
+)
+
+// ConnectionInfo describes an open client connection. Agency is zero until
+// the connection sends a message that identifies its agency.
+type ConnectionInfo struct {
+	ID            uint64    `json:"id"`
+	RemoteAddr    string    `json:"remote_addr"`
+	Agency        int       `json:"agency"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	BytesReceived int64     `json:"bytes_received"`
+	BytesSent     int64     `json:"bytes_sent"`
+	Operation     string    `json:"operation"`
+}
+
+// TrackedConn is a client connection registered in a ConnectionRegistry.
+// It counts the bytes read and written through it.
+type TrackedConn struct {
+	net.Conn
+	id          uint64
+	connectedAt time.Time
+	received    int64
+	sent        int64
+	lock        sync.Mutex
+	agency      int
+	operation   string
+}
+
+func (c *TrackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.received, int64(n))
+	return n, err
+}
+
+func (c *TrackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.sent, int64(n))
+	return n, err
+}
+
+// SetAgency records the agency the connection belongs to.
+func (c *TrackedConn) SetAgency(agency int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.agency = agency
+}
+
+// SetOperation records what the connection is doing, one of the
+// Operation* constants.
+func (c *TrackedConn) SetOperation(operation string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.operation = operation
+}
+
+// Info returns the current state of the connection.
+func (c *TrackedConn) Info() ConnectionInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return ConnectionInfo{
+		ID:            c.id,
+		RemoteAddr:    c.RemoteAddr().String(),
+		Agency:        c.agency,
+		ConnectedAt:   c.connectedAt,
+		BytesReceived: atomic.LoadInt64(&c.received),
+		BytesSent:     atomic.LoadInt64(&c.sent),
+		Operation:     c.operation,
+	}
+}
+
+// ConnectionRegistry keeps track of the open client connections, so that
+// they can be listed and closed by agency.
+type ConnectionRegistry struct {
+	lock   sync.Mutex
+	nextID uint64
+	conns  map[uint64]*TrackedConn
+}
+
+// NewConnectionRegistry creates an empty registry.
+func NewConnectionRegistry() *ConnectionRegistry {
+	return &ConnectionRegistry{conns: map[uint64]*TrackedConn{}}
+}
+
+// Add registers the connection, which is reading its first message.
+func (r *ConnectionRegistry) Add(conn net.Conn) *TrackedConn {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.nextID++
+	tracked := &TrackedConn{Conn: conn, id: r.nextID, connectedAt: time.Now(), operation: OperationReading}
+	r.conns[tracked.id] = tracked
+	return tracked
+}
+
+// Remove closes the connection and stops tracking it. Returns false if it
+// was already removed or closed through the registry.
+func (r *ConnectionRegistry) Remove(conn *TrackedConn) bool {
+	r.lock.Lock()
+	_, ok := r.conns[conn.id]
+	delete(r.conns, conn.id)
+	r.lock.Unlock()
+	if ok {
+		conn.Close()
+	}
+	return ok
+}
+
+// List returns the open connections, in the order they were accepted.
+func (r *ConnectionRegistry) List() []ConnectionInfo {
+	r.lock.Lock()
+	conns := make([]*TrackedConn, 0, len(r.conns))
+	for _, conn := range r.conns {
+		conns = append(conns, conn)
+	}
+	r.lock.Unlock()
+
+	infos := make([]ConnectionInfo, 0, len(conns))
+	for _, conn := range conns {
+		infos = append(infos, conn.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// CloseAgency closes the open connections of the agency and returns them.
+func (r *ConnectionRegistry) CloseAgency(agency int) []ConnectionInfo {
+	return r.closeMatching(func(info ConnectionInfo) bool { return info.Agency == agency })
+}
+
+// CloseAll closes every open connection and returns them.
+func (r *ConnectionRegistry) CloseAll() []ConnectionInfo {
+	return r.closeMatching(func(ConnectionInfo) bool { return true })
+}
+
+func (r *ConnectionRegistry) closeMatching(matches func(ConnectionInfo) bool) []ConnectionInfo {
+	var closed []ConnectionInfo
+	for _, info := range r.List() {
+		if !matches(info) {
+			continue
+		}
+		r.lock.Lock()
+		conn, ok := r.conns[info.ID]
+		delete(r.conns, info.ID)
+		r.lock.Unlock()
+		if ok {
+			conn.Close()
+			closed = append(closed, info)
+		}
+	}
+	return closed
+}
@@ -0,0 +1,177 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Policies applied to duplicated bets and documents.
+const (
+	// DuplicatePolicyReject rejects the duplicated bet.
+	DuplicatePolicyReject = "reject"
+	// DuplicatePolicyFlag stores the bet and reports its document at the end of the contest.
+	DuplicatePolicyFlag = "flag"
+	// DuplicatePolicyAccept stores the bet without further notice.
+	DuplicatePolicyAccept = "accept"
+)
+
+// ParseDuplicatePolicy validates the name of a duplicate policy.
+func ParseDuplicatePolicy(policy string) (string, error) {
+	switch policy {
+	case DuplicatePolicyReject, DuplicatePolicyFlag, DuplicatePolicyAccept:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown duplicate policy %q", policy)
+}
+
+// betKey identifies a bet by all of its fields.
+type betKey struct {
+	agency    int
+	firstName string
+	lastName  string
+	document  string
+	birthdate string
+	number    int
+}
+
+func newBetKey(bet Bet) betKey {
+	return betKey{
+		agency:    bet.Agency,
+		firstName: bet.FirstName,
+		lastName:  bet.LastName,
+		document:  bet.Document,
+		birthdate: bet.Birthdate.Format("2006-01-02"),
+		number:    bet.Number,
+	}
+}
+
+// FlaggedDocument is an entry of the duplicates report: a document that
+// appeared in duplicated bets or in bets of more than one agency.
+type FlaggedDocument struct {
+	Document string
+	Agencies []int
+	Reasons  []string
+}
+
+// DuplicateDetector remembers the stored bets to detect bets that are stored
+// twice and documents that bet through more than one agency. It counts how
+// many stored bets share a key or a document, so that forgetting one of them
+// keeps the others.
+// It is safe for concurrent use.
+type DuplicateDetector struct {
+	lock      sync.Mutex
+	bets      map[betKey]int
+	documents map[string]map[int]int
+	flagged   map[string]map[string]bool
+}
+
+// NewDuplicateDetector creates a detector that knows no bets.
+func NewDuplicateDetector() *DuplicateDetector {
+	return &DuplicateDetector{
+		bets:      map[betKey]int{},
+		documents: map[string]map[int]int{},
+		flagged:   map[string]map[string]bool{},
+	}
+}
+
+// Find returns ReasonDuplicatedBet if the bet was already recorded or is among
+// pending, ReasonDuplicatedDocument if its document was used by another agency,
+// or an empty string if the bet is not a duplicate.
+func (d *DuplicateDetector) Find(bet Bet, pending []Bet) string {
+	key := newBetKey(bet)
+	for _, other := range pending {
+		if newBetKey(other) == key {
+			return ReasonDuplicatedBet
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.bets[key] > 0 {
+		return ReasonDuplicatedBet
+	}
+	for agency := range d.documents[bet.Document] {
+		if agency != bet.Agency {
+			return ReasonDuplicatedDocument
+		}
+	}
+	for _, other := range pending {
+		if other.Document == bet.Document && other.Agency != bet.Agency {
+			return ReasonDuplicatedDocument
+		}
+	}
+	return ""
+}
+
+// Record remembers stored bets so that later duplicates can be found.
+func (d *DuplicateDetector) Record(bets []Bet) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, bet := range bets {
+		d.bets[newBetKey(bet)]++
+		if d.documents[bet.Document] == nil {
+			d.documents[bet.Document] = map[int]int{}
+		}
+		d.documents[bet.Document][bet.Agency]++
+	}
+}
+
+// Forget undoes the Record of a bet that is no longer stored, because it was
+// cancelled or amended.
+func (d *DuplicateDetector) Forget(bet Bet) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	key := newBetKey(bet)
+	if d.bets[key] > 1 {
+		d.bets[key]--
+	} else {
+		delete(d.bets, key)
+	}
+	agencies := d.documents[bet.Document]
+	if agencies[bet.Agency] > 1 {
+		agencies[bet.Agency]--
+		return
+	}
+	delete(agencies, bet.Agency)
+	if len(agencies) == 0 {
+		delete(d.documents, bet.Document)
+	}
+}
+
+// Flag adds the document of the bet to the duplicates report.
+func (d *DuplicateDetector) Flag(bet Bet, reason string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.flagged[bet.Document] == nil {
+		d.flagged[bet.Document] = map[string]bool{}
+	}
+	d.flagged[bet.Document][reason] = true
+}
+
+// Report lists the flagged documents sorted by document, along with every
+// agency the document bet through.
+func (d *DuplicateDetector) Report() []FlaggedDocument {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	report := make([]FlaggedDocument, 0, len(d.flagged))
+	for document, reasons := range d.flagged {
+		agencies := map[int]bool{}
+		for agency := range d.documents[document] {
+			agencies[agency] = true
+		}
+		entry := FlaggedDocument{
+			Document: document,
+			Agencies: sortedKeys(agencies),
+		}
+		for reason := range reasons {
+			entry.Reasons = append(entry.Reasons, reason)
+		}
+		sort.Strings(entry.Reasons)
+		report = append(report, entry)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Document < report[j].Document
+	})
+	return report
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// Ready returns nil if the server is accepting bets, or the reason why it
+// is not.
+func (s *Server) Ready() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("server shutting down")
+	}
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	if s.archived {
+		return fmt.Errorf("contest archived")
+	}
+	if s.winnerRevealed {
+		return fmt.Errorf("draw closed, bets no longer accepted")
+	}
+	return nil
+}
+
+// handlePingMessage answers Pong if the server is accepting bets, or an
+// error with the reason why it is not.
+func (s *Server) handlePingMessage(clientConn net.Conn) {
+	if err_ready := s.Ready(); err_ready != nil {
+		log.Info("ping", "fail", logger.F("error", err_ready))
+		s.sendError(clientConn, err_ready.Error())
+		return
+	}
+	s.sendReply(clientConn, common.Pong)
+}
+
+// handleLiveness answers 200 as long as the process is able to serve
+// requests.
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// handleReadiness answers 200 if the server is accepting bets and 503
+// otherwise.
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if err_ready := s.Ready(); err_ready != nil {
+		writeAdminJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not_ready", "reason": err_ready.Error()})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
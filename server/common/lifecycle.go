@@ -0,0 +1,142 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// Policies that decide what the server does once every agency that took
+// part in the draw received its winners.
+const (
+	// LifecyclePolicyExit shuts the server down right away.
+	LifecyclePolicyExit = "exit"
+	// LifecyclePolicyGracePeriod shuts the server down once the results
+	// grace period passes, so that late queries can still be answered.
+	LifecyclePolicyGracePeriod = "grace_period"
+	// LifecyclePolicyStayUp keeps the server running until it is stopped.
+	LifecyclePolicyStayUp = "stay_up"
+)
+
+// ParseLifecyclePolicy validates the name of a lifecycle policy.
+func ParseLifecyclePolicy(policy string) (string, error) {
+	switch policy {
+	case LifecyclePolicyExit, LifecyclePolicyGracePeriod, LifecyclePolicyStayUp:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown lifecycle policy %q", policy)
+}
+
+// ResultsDelivered returns a channel that is closed once every agency that
+// took part in the draw received the last page of its winners.
+func (s *Server) ResultsDelivered() <-chan struct{} {
+	return s.resultsDelivered
+}
+
+// ShutdownDue returns a channel that is closed when the lifecycle policy
+// says the server must shut down. The server does not shut itself down;
+// whoever runs it is expected to call GracefulShutdown. The channel is
+// never closed under LifecyclePolicyStayUp, nor if the server is shut
+// down before.
+func (s *Server) ShutdownDue() <-chan struct{} {
+	due := make(chan struct{})
+	if s.lifecyclePolicy == LifecyclePolicyStayUp {
+		return due
+	}
+	go func() {
+		select {
+		case <-s.resultsDelivered:
+		case <-s.closed:
+			return
+		}
+		if s.lifecyclePolicy == LifecyclePolicyGracePeriod {
+			log.Info("periodo_de_gracia", "in_progress", logger.F("duracion", s.resultsGracePeriod))
+			grace := time.NewTimer(s.resultsGracePeriod)
+			defer grace.Stop()
+			select {
+			case <-grace.C:
+			case <-s.closed:
+				return
+			}
+		}
+		close(due)
+	}()
+	return due
+}
+
+// markResultsDelivered records that an agency got all of its winners and
+// signals ResultsDelivered once none is left waiting. Must be called holding
+// lockWinnerRevealed.
+func (s *Server) markResultsDelivered(agency int) {
+	delete(s.agenciesWaiting, agency)
+	s.checkResultsDelivered()
+}
+
+// checkResultsDelivered signals ResultsDelivered if the draw was performed
+// and no agency is left waiting for its winners. Must be called holding
+// lockWinnerRevealed.
+func (s *Server) checkResultsDelivered() {
+	if s.winnerRevealed && len(s.agenciesWaiting) == 0 {
+		s.deliveredOnce.Do(func() {
+			log.Info("resultados_entregados", "success")
+			close(s.resultsDelivered)
+		})
+	}
+}
+
+// Drain stops accepting new connections and lets the ones in progress
+// finish, after which Run returns. Unlike GracefulShutdown, the open client
+// connections are not closed.
+func (s *Server) Drain() {
+	log.Info("drain", "in_progress")
+	s.stopAccepting()
+}
+
+// stopAccepting marks the server as not running and closes the listener,
+// so that Run returns once the handlers in progress finish.
+func (s *Server) stopAccepting() {
+	s.runningLock.Lock()
+	s.running = false
+	s.runningLock.Unlock()
+	s.closeOnce.Do(func() { close(s.closed) })
+
+	s.lockWinnerRevealed.Lock()
+	if s.drawTimer != nil {
+		s.drawTimer.Stop()
+	}
+	s.lockWinnerRevealed.Unlock()
+
+	if err := s.listener.Close(); err != nil {
+		log.Info("listener.Close() finished", "success", logger.F("error", err))
+	} else {
+		log.Info("listener.Close() finished", "success")
+	}
+}
+
+// waitForHandlers waits up to the timeout for Run to return, which happens
+// once every handler finished. Returns false if the timeout passed first.
+func (s *Server) waitForHandlers(timeout time.Duration) bool {
+	s.lockWinnerRevealed.Lock()
+	started := !s.startedAt.IsZero()
+	s.lockWinnerRevealed.Unlock()
+	if !started {
+		return true
+	}
+	select {
+	case <-s.runDone:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case <-s.runDone:
+		return true
+	case <-deadline.C:
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"encoding/csv"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// acquireHandlerSlot waits until fewer than the maximum amount of handlers
+// are running, so that the connections that can not be handled yet wait in
+// the listen backlog. Returns false if the server is closed while waiting.
+func (s *Server) acquireHandlerSlot() bool {
+	if s.handlerSlots == nil {
+		return true
+	}
+	select {
+	case s.handlerSlots <- struct{}{}:
+		return true
+	default:
+	}
+	log.Warning("accept_connections", "in_progress", logger.F("handlers", cap(s.handlerSlots)), logger.F("msg", "max connections reached"))
+	select {
+	case s.handlerSlots <- struct{}{}:
+		return true
+	case <-s.closed:
+		return false
+	}
+}
+
+// releaseHandlerSlot frees the slot taken by a handler that finished.
+func (s *Server) releaseHandlerSlot() {
+	if s.handlerSlots != nil {
+		<-s.handlerSlots
+	}
+}
+
+// messageAgency returns the agency that sent the message, which is the
+// first field of its body, and false if it does not start with an agency id.
+func messageAgency(msgStr string) (int, bool) {
+	_, body := common.ParseMessage(msgStr)
+	fields, err_reading := csv.NewReader(strings.NewReader(body)).Read()
+	if err_reading != nil {
+		return 0, false
+	}
+	agency, err_parsing := strconv.Atoi(fields[0])
+	return agency, err_parsing == nil
+}
+
+// allowMessage takes a token from the rate limit of the agency that sent a
+// message, answering the client with a retryable error if it has none
+// left. Messages from agencies that are not registered are let through to
+// be rejected by their handler, so that made-up agency ids do not get a
+// bucket of their own.
+func (s *Server) allowMessage(clientConn net.Conn, agency int) bool {
+	if !s.registry.IsRegistered(agency) || s.rateLimiter.Allow(agency) {
+		return true
+	}
+	log.Warning("rate_limit", "fail", logger.F("agency", agency))
+	s.metrics.rateLimited.Inc(strconv.Itoa(agency))
+	s.sendError(clientConn, common.ReasonRateLimited)
+	return false
+}
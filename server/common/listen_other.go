@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package common
+
+import "net"
+
+// listenTCP listens on addr. The backlog can not be set on this platform,
+// so the system default is used.
+func listenTCP(addr string, backlog int) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
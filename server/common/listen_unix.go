@@ -0,0 +1,36 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package common
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenTCP listens on addr with a queue of at most backlog pending
+// connections. The net package always uses the system maximum, so the
+// socket is put in listening state again with the configured backlog.
+func listenTCP(addr string, backlog int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil || backlog <= 0 {
+		return listener, err
+	}
+	rawConn, err := listener.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	var err_listen error
+	err = rawConn.Control(func(fd uintptr) {
+		err_listen = syscall.Listen(int(fd), backlog)
+	})
+	if err == nil {
+		err = err_listen
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
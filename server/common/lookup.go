@@ -0,0 +1,75 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// handleLookupMessage answers, once the draw was performed, with the result
+// of every bet the asking agency stored for the document given as argument.
+// Bets stored through other agencies are never disclosed.
+func (s *Server) handleLookupMessage(clientConn net.Conn, agencyStr string, args []string) {
+	if len(args) != 1 || args[0] == "" {
+		s.sendError(clientConn, "invalid lookup request")
+		return
+	}
+	agency, err_agency := s.registeredAgency(agencyStr)
+	if err_agency != nil {
+		s.sendError(clientConn, err_agency.Error())
+		return
+	}
+	document := args[0]
+
+	s.lockWinnerRevealed.Lock()
+	revealed, absent, archived := s.winnerRevealed, s.absentAgencies[agency], s.archived
+	s.lockWinnerRevealed.Unlock()
+	if archived {
+		s.sendError(clientConn, "contest archived")
+		return
+	}
+	if !revealed {
+		log.Info("consulta_apostador", "in_progress", logger.F("agency", agency), logger.F("dni", document))
+		s.sendReply(clientConn, common.NoWinnersYet)
+		return
+	}
+	if absent {
+		s.sendError(clientConn, fmt.Sprintf("agency %d absent from draw", agency))
+		return
+	}
+
+	results, err_lookup := s.lookupBettor(agency, document)
+	if err_lookup != nil {
+		log.Error("consulta_apostador", "fail", logger.F("agency", agency), logger.F("dni", document), logger.F("error", err_lookup))
+		s.sendError(clientConn, "could not load stored bets")
+		return
+	}
+	log.Info("consulta_apostador", "success", logger.F("agency", agency), logger.F("dni", document), logger.F("apuestas", len(results)))
+	s.sendReply(clientConn, common.EncodeBetResults(results))
+}
+
+// lookupBettor returns the draw result of the bets the agency stored for
+// the document, in the order they were stored.
+func (s *Server) lookupBettor(agency int, document string) ([]common.BetResult, error) {
+	s.betsLock.Lock()
+	bets, err_loading_bets := LoadBets()
+	s.betsLock.Unlock()
+	if err_loading_bets != nil && !os.IsNotExist(err_loading_bets) {
+		return nil, err_loading_bets
+	}
+
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	var results []common.BetResult
+	for _, bet := range bets {
+		if bet.Agency != agency || bet.Document != document {
+			continue
+		}
+		prize, won := s.drawPrizes[newBetKey(bet)]
+		results = append(results, common.BetResult{Number: bet.Number, Won: won, Payout: prize.Payout})
+	}
+	return results, nil
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"net/http"
+
+	metrics "github.com/7574-sistemas-distribuidos/docker-compose-init/metrics/common"
+)
+
+// Upper bounds of the buckets of the batch size histogram, in bets.
+var batchSizeBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000}
+
+// Upper bounds of the buckets of the store latency histogram, in seconds.
+var storeLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// unknownAgencyLabel is the agency label of the metrics about agencies that
+// are not registered.
+const unknownAgencyLabel = "unknown"
+
+// serverMetrics holds the metrics the server exposes through MetricsHandler.
+type serverMetrics struct {
+	registry            *metrics.Registry
+	connectionsAccepted *metrics.Counter
+	framesRead          *metrics.Counter
+	framesWritten       *metrics.Counter
+	bytesReceived       *metrics.Counter
+	bytesSent           *metrics.Counter
+	betsStored          *metrics.Counter
+	betsRejected        *metrics.Counter
+	batchSize           *metrics.Histogram
+	storeLatency        *metrics.Histogram
+	winnersQueries      *metrics.Counter
+	noWinnersYet        *metrics.Counter
+	rateLimited         *metrics.Counter
+}
+
+func newServerMetrics() *serverMetrics {
+	registry := metrics.NewRegistry()
+	return &serverMetrics{
+		registry:            registry,
+		connectionsAccepted: registry.NewCounter("lottery_connections_accepted_total", "Client connections accepted."),
+		framesRead:          registry.NewCounter("lottery_frames_read_total", "Protocol frames read from clients."),
+		framesWritten:       registry.NewCounter("lottery_frames_written_total", "Protocol frames written to clients."),
+		bytesReceived:       registry.NewCounter("lottery_bytes_received_total", "Bytes read from client connections."),
+		bytesSent:           registry.NewCounter("lottery_bytes_sent_total", "Bytes written to client connections."),
+		betsStored:          registry.NewCounter("lottery_bets_stored_total", "Bets stored, by agency.", "agency"),
+		betsRejected:        registry.NewCounter("lottery_bets_rejected_total", "Bets rejected, by agency and reason.", "agency", "reason"),
+		batchSize:           registry.NewHistogram("lottery_batch_size_bets", "Bets received in each batch.", batchSizeBuckets),
+		storeLatency:        registry.NewHistogram("lottery_store_latency_seconds", "Time spent storing each batch of bets.", storeLatencyBuckets),
+		winnersQueries:      registry.NewCounter("lottery_winners_queries_total", "Winners requests received, by agency.", "agency"),
+		noWinnersYet:        registry.NewCounter("lottery_no_winners_yet_total", "Requests answered with \"No winners yet\"."),
+		rateLimited:         registry.NewCounter("lottery_rate_limited_total", "Messages rejected by the rate limit, by agency.", "agency"),
+	}
+}
+
+// MetricsHandler returns an HTTP handler that serves the metrics of the
+// server in the Prometheus text exposition format.
+func (s *Server) MetricsHandler() http.Handler {
+	return s.metrics.registry.Handler()
+}
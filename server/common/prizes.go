@@ -0,0 +1,114 @@
+package common
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxPrizeTiers is the amount of tiers available: a bet is in tier t when the
+// last 5-t digits of its number match the winner number.
+const maxPrizeTiers = 4
+
+// PrizeRules holds how the prize pool is distributed. HousePercentage is kept
+// by the house; TierSplits[t-1] is the percentage of the remaining pool shared
+// by the bets in tier t, proportionally to their stakes.
+type PrizeRules struct {
+	HousePercentage int
+	TierSplits      []int
+}
+
+// DefaultPrizeRules gives the whole pool to the bets matching all the digits.
+var DefaultPrizeRules = PrizeRules{HousePercentage: 0, TierSplits: []int{100}}
+
+// Prize is the payout, in cents, of a winning bet.
+type Prize struct {
+	Bet    Bet
+	Tier   int
+	Payout int64
+}
+
+// ParseTierSplits parses a comma separated list of tier percentages, e.g. "80,15,5".
+func ParseTierSplits(list string) ([]int, error) {
+	var splits []int
+	for _, field := range strings.Split(list, ",") {
+		split, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tier percentage %q", field)
+		}
+		splits = append(splits, split)
+	}
+	return splits, nil
+}
+
+// Validate checks that the percentages are consistent.
+func (r PrizeRules) Validate() error {
+	if r.HousePercentage < 0 || r.HousePercentage > 100 {
+		return fmt.Errorf("house percentage %d not in [0, 100]", r.HousePercentage)
+	}
+	if len(r.TierSplits) == 0 || len(r.TierSplits) > maxPrizeTiers {
+		return fmt.Errorf("between 1 and %d prize tiers are required, got %d", maxPrizeTiers, len(r.TierSplits))
+	}
+	total := 0
+	for _, split := range r.TierSplits {
+		if split < 0 {
+			return fmt.Errorf("tier percentage %d must not be negative", split)
+		}
+		total += split
+	}
+	if total > 100 {
+		return fmt.Errorf("tier percentages add up to %d, more than 100", total)
+	}
+	return nil
+}
+
+// prizeTier returns the tier of the bet, or 0 if it did not win.
+func (r PrizeRules) prizeTier(bet Bet) int {
+	modulo := 10000
+	for tier := 1; tier <= len(r.TierSplits); tier++ {
+		if bet.Number%modulo == lotteryWinnerNumber%modulo {
+			return tier
+		}
+		modulo /= 10
+	}
+	return 0
+}
+
+// ComputePrizes returns the prize pool, made of the stakes of every bet, and
+// the prizes of the winning bets in the same order as bets. Whatever cannot
+// be split evenly, or belongs to a tier without winners, stays with the house.
+func ComputePrizes(bets []Bet, rules PrizeRules) (int64, []Prize) {
+	var pool int64
+	var tierStakes = make([]int64, len(rules.TierSplits)+1)
+	var tierWinners = make([]int64, len(rules.TierSplits)+1)
+	var prizes []Prize
+	for _, bet := range bets {
+		pool += bet.Amount
+		if tier := rules.prizeTier(bet); tier > 0 {
+			tierStakes[tier] += bet.Amount
+			tierWinners[tier]++
+			prizes = append(prizes, Prize{Bet: bet, Tier: tier})
+		}
+	}
+
+	net := pool - mulDiv(pool, int64(rules.HousePercentage), 100)
+	for i := range prizes {
+		tier := prizes[i].Tier
+		tierPool := mulDiv(net, int64(rules.TierSplits[tier-1]), 100)
+		if tierStakes[tier] > 0 {
+			prizes[i].Payout = mulDiv(tierPool, prizes[i].Bet.Amount, tierStakes[tier])
+		} else {
+			prizes[i].Payout = tierPool / tierWinners[tier]
+		}
+	}
+	return pool, prizes
+}
+
+// mulDiv returns a*b/c without overflowing in the product. The result fits
+// in an int64 as long as b is not greater than c, which holds for every
+// share of the pool.
+func mulDiv(a int64, b int64, c int64) int64 {
+	product := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	return product.Quo(product, big.NewInt(c)).Int64()
+}
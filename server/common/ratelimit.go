@@ -0,0 +1,66 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the messages each agency can send with a token bucket
+// per agency: every message takes a token, and tokens are refilled at Rate
+// per second up to Burst. A limiter with a Rate of zero allows everything.
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+	// Now returns the current time; time.Now if nil. Tests override it.
+	Now func() time.Time
+
+	lock    sync.Mutex
+	buckets map[int]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter that allows rate messages per second to
+// each agency, with bursts of up to burst messages. A burst lower than one
+// allows a single message at a time.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{Rate: rate, Burst: burst, buckets: map[int]*tokenBucket{}}
+}
+
+// Allow takes a token from the bucket of the agency, returning false if it
+// has none left.
+func (l *RateLimiter) Allow(agency int) bool {
+	if l.Rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	bucket, ok := l.buckets[agency]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.Burst), last: now}
+		l.buckets[agency] = bucket
+	}
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens += elapsed * l.Rate
+		if bucket.tokens > float64(l.Burst) {
+			bucket.tokens = float64(l.Burst)
+		}
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// rejectionsFilePath is the file where the amount of bets rejected in each
+// batch is kept, next to the stored bets, so that reconciliations stay
+// right after a restart.
+const rejectionsFilePath = "./rejections.csv"
+
+// StoreRejections records that count bets of a batch sent by the agency
+// were rejected.
+// Not thread-safe/process-safe.
+func StoreRejections(agency int, count int) error {
+	return appendRows(rejectionsFilePath, [][]string{{strconv.Itoa(agency), strconv.Itoa(count)}})
+}
+
+// LoadRejections returns the amount of bets rejected for each agency.
+// Returns an error satisfying os.IsNotExist if no bet was rejected yet.
+// Not thread-safe/process-safe.
+func LoadRejections() (map[int]int, error) {
+	file, err_opening := os.Open(rejectionsFilePath)
+	if err_opening != nil {
+		return nil, err_opening
+	}
+	defer file.Close()
+
+	records, err_reading := csv.NewReader(file).ReadAll()
+	if err_reading != nil {
+		return nil, err_reading
+	}
+	rejected := map[int]int{}
+	for _, row := range records {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("invalid rejections row: %v", row)
+		}
+		agency, err_agency := strconv.Atoi(row[0])
+		if err_agency != nil {
+			return nil, err_agency
+		}
+		count, err_count := strconv.Atoi(row[1])
+		if err_count != nil {
+			return nil, err_count
+		}
+		rejected[agency] += count
+	}
+	return rejected, nil
+}
+
+// recordRejections counts the bets of a batch sent by the agency that were
+// rejected, persisting them so that they survive a restart. Rejections of
+// agencies that are not registered are not counted. Must be called holding
+// betsLock.
+func (s *Server) recordRejections(agency int, count int) {
+	if count == 0 || !s.registry.IsRegistered(agency) {
+		return
+	}
+	if err_storing := StoreRejections(agency, count); err_storing != nil {
+		log.Error("store_rejections", "fail", logger.F("agency", agency), logger.F("error", err_storing))
+	}
+	s.statsLock.Lock()
+	s.rejectedBets[agency] += count
+	s.statsLock.Unlock()
+}
+
+// handleFinishedMessage marks the agency as finished and answers with the
+// reconciliation summary of the bets the server holds for it.
+func (s *Server) handleFinishedMessage(clientConn net.Conn, agencyStr string) {
+	agency, err_agency := s.registeredAgency(agencyStr)
+	if err_agency != nil {
+		log.Error("conciliacion", "fail", logger.F("agency", agencyStr), logger.F("error", err_agency))
+		s.sendError(clientConn, err_agency.Error())
+		return
+	}
+
+	s.lockWinnerRevealed.Lock()
+	if !s.winnerRevealed {
+		s.markAgencyFinished(agency)
+	}
+	s.lockWinnerRevealed.Unlock()
+
+	reconciliation, err_reconciling := s.reconcile(agency)
+	if err_reconciling != nil {
+		log.Error("conciliacion", "fail", logger.F("agency", agency), logger.F("error", err_reconciling))
+		s.sendError(clientConn, "could not load stored bets")
+		return
+	}
+	log.Info("conciliacion", "success",
+		logger.F("agency", agency),
+		logger.F("almacenadas", reconciliation.Stored),
+		logger.F("rechazadas", reconciliation.Rejected),
+		logger.F("digest", reconciliation.Digest),
+	)
+	s.sendReply(clientConn, reconciliation.Encode())
+}
+
+// markAgencyFinished records that the agency finished sending its bets and
+// is waiting for the draw. Must be called holding lockWinnerRevealed.
+func (s *Server) markAgencyFinished(agency int) {
+	s.agenciesWaiting[agency] = true
+	s.registry.MarkFinished(agency)
+}
+
+// reconcile summarizes the bets stored for the agency, in the order they
+// were stored, and how many of the bets it sent were rejected.
+func (s *Server) reconcile(agency int) (common.Reconciliation, error) {
+	s.betsLock.Lock()
+	bets, err_loading_bets := LoadBets()
+	s.betsLock.Unlock()
+	if err_loading_bets != nil && !os.IsNotExist(err_loading_bets) {
+		return common.Reconciliation{}, err_loading_bets
+	}
+
+	digest := common.NewBetDigest()
+	stored := 0
+	for _, bet := range bets {
+		if bet.Agency != agency {
+			continue
+		}
+		digest.Add(bet.FirstName, bet.LastName, bet.Document, bet.Birthdate.Format("2006-01-02"), bet.Number, bet.Amount)
+		stored++
+	}
+
+	s.statsLock.Lock()
+	rejected := s.rejectedBets[agency]
+	s.statsLock.Unlock()
+	return common.Reconciliation{Stored: stored, Rejected: rejected, Digest: digest.Sum()}, nil
+}
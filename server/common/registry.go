@@ -0,0 +1,127 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AgencyRegistry keeps the set of agencies expected to take part in the
+// contest and which of them already finished sending their bets.
+// It is safe for concurrent use.
+type AgencyRegistry struct {
+	lock     sync.Mutex
+	expected map[int]bool
+	finished map[int]bool
+}
+
+// NewAgencyRegistry creates a registry expecting the given agencies.
+func NewAgencyRegistry(agencies []int) *AgencyRegistry {
+	registry := &AgencyRegistry{
+		expected: map[int]bool{},
+		finished: map[int]bool{},
+	}
+	for _, agency := range agencies {
+		registry.expected[agency] = true
+	}
+	return registry
+}
+
+// ParseAgencies parses a comma separated list of agency IDs, e.g. "1,2,5".
+func ParseAgencies(list string) ([]int, error) {
+	var agencies []int
+	seen := map[int]bool{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		agency, err := strconv.Atoi(field)
+		if err != nil || agency <= 0 {
+			return nil, fmt.Errorf("invalid agency id %q", field)
+		}
+		if seen[agency] {
+			return nil, fmt.Errorf("agency id %d listed twice", agency)
+		}
+		seen[agency] = true
+		agencies = append(agencies, agency)
+	}
+	return agencies, nil
+}
+
+// Register adds an agency to the set of expected agencies.
+func (r *AgencyRegistry) Register(agency int) error {
+	if agency <= 0 {
+		return fmt.Errorf("invalid agency id %d", agency)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.expected[agency] {
+		return fmt.Errorf("agency %d already registered", agency)
+	}
+	r.expected[agency] = true
+	return nil
+}
+
+// IsRegistered returns whether the agency is expected in the contest.
+func (r *AgencyRegistry) IsRegistered(agency int) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.expected[agency]
+}
+
+// MarkFinished records that a registered agency finished sending its bets.
+func (r *AgencyRegistry) MarkFinished(agency int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.expected[agency] {
+		r.finished[agency] = true
+	}
+}
+
+// HasFinished returns whether the agency already finished sending its bets.
+func (r *AgencyRegistry) HasFinished(agency int) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.finished[agency]
+}
+
+// AllFinished returns true when there is at least one expected agency
+// and every one of them finished sending its bets.
+func (r *AgencyRegistry) AllFinished() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.expected) > 0 && len(r.finished) == len(r.expected)
+}
+
+// Agencies returns the expected agencies in ascending order.
+func (r *AgencyRegistry) Agencies() []int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return sortedKeys(r.expected)
+}
+
+// Missing returns, in ascending order, the expected agencies that
+// have not finished sending their bets yet.
+func (r *AgencyRegistry) Missing() []int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	missing := map[int]bool{}
+	for agency := range r.expected {
+		if !r.finished[agency] {
+			missing[agency] = true
+		}
+	}
+	return sortedKeys(missing)
+}
+
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
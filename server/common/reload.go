@@ -0,0 +1,146 @@
+package common
+
+import (
+	"reflect"
+	"time"
+
+	reload "github.com/7574-sistemas-distribuidos/docker-compose-init/reload/common"
+)
+
+// Reload applies the settings of config that can change while the contest
+// is in progress: log level and format (which only the binary can apply),
+// draw deadline, min age, duplicate policy, winners page size and shutdown
+// timeout. Changes to any other setting are reported as requiring a
+// restart. Nothing is applied if config is not valid.
+func (s *Server) Reload(config ServerConfig) (reload.ConfigChanges, error) {
+	if err := config.Validate(); err != nil {
+		return reload.ConfigChanges{}, err
+	}
+	var changes reload.ConfigChanges
+
+	s.settingsLock.Lock()
+	current := s.config
+	if config.LogLevel != current.LogLevel {
+		changes.Applied = append(changes.Applied, "logging_level")
+	}
+	if config.LogFormat != current.LogFormat {
+		changes.Applied = append(changes.Applied, "log_format")
+	}
+	if config.MinAge != current.MinAge {
+		s.validationRules = ValidationRules{MinAge: config.MinAge}
+		changes.Applied = append(changes.Applied, "min_age")
+	}
+	if config.DuplicatePolicy != current.DuplicatePolicy {
+		s.duplicatePolicy = config.DuplicatePolicy
+		if s.duplicatePolicy == "" {
+			s.duplicatePolicy = DuplicatePolicyFlag
+		}
+		changes.Applied = append(changes.Applied, "duplicate_policy")
+	}
+	if config.WinnersPageSize != current.WinnersPageSize {
+		s.winnersPageSize = config.WinnersPageSize
+		if s.winnersPageSize <= 0 {
+			s.winnersPageSize = DefaultWinnersPageSize
+		}
+		changes.Applied = append(changes.Applied, "winners_page_size")
+	}
+	if config.ShutdownTimeout != current.ShutdownTimeout {
+		s.shutdownTimeout = config.ShutdownTimeout
+		changes.Applied = append(changes.Applied, "shutdown_timeout")
+	}
+	s.settingsLock.Unlock()
+
+	if config.DrawDeadline != current.DrawDeadline {
+		s.setDrawDeadline(config.DrawDeadline)
+		changes.Applied = append(changes.Applied, "draw_deadline")
+	}
+
+	restartRequired := []struct {
+		name    string
+		changed bool
+	}{
+		{"server_ip", config.IP != current.IP},
+		{"server_port", config.Port != current.Port},
+		{"server_listen_backlog", config.ListenBacklog != current.ListenBacklog},
+		{"agencies", !reflect.DeepEqual(config.Agencies, current.Agencies)},
+		{"receipt_key", config.ReceiptKey != current.ReceiptKey},
+		{"prize_rules", !reflect.DeepEqual(config.PrizeRules, current.PrizeRules)},
+		{"lifecycle_policy", config.LifecyclePolicy != current.LifecyclePolicy},
+		{"results_grace_period", config.ResultsGracePeriod != current.ResultsGracePeriod},
+		{"max_connections", config.MaxConnections != current.MaxConnections},
+		{"rate_limit", config.RateLimit != current.RateLimit},
+		{"rate_burst", config.RateBurst != current.RateBurst},
+		{"admin_address", config.AdminAddress != current.AdminAddress},
+		{"metrics_address", config.MetricsAddress != current.MetricsAddress},
+	}
+	for _, setting := range restartRequired {
+		if setting.changed {
+			changes.RestartRequired = append(changes.RestartRequired, setting.name)
+		}
+	}
+
+	// The settings that require a restart keep the value in use, so that
+	// they are reported again on the next reload.
+	s.settingsLock.Lock()
+	s.config.LogLevel = config.LogLevel
+	s.config.LogFormat = config.LogFormat
+	s.config.MinAge = config.MinAge
+	s.config.DuplicatePolicy = config.DuplicatePolicy
+	s.config.WinnersPageSize = config.WinnersPageSize
+	s.config.DrawDeadline = config.DrawDeadline
+	s.config.ShutdownTimeout = config.ShutdownTimeout
+	s.settingsLock.Unlock()
+	return changes, nil
+}
+
+// setDrawDeadline reschedules the draw so that it happens once the deadline
+// passes, measured from the moment Run was called. If it already passed the
+// draw is performed right away; a zero deadline waits for every agency.
+func (s *Server) setDrawDeadline(deadline time.Duration) {
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	s.drawDeadline = deadline
+	if s.startedAt.IsZero() || s.winnerRevealed {
+		return
+	}
+	if s.drawTimer != nil {
+		s.drawTimer.Stop()
+		s.drawTimer = nil
+	}
+	if deadline > 0 {
+		remaining := time.Until(s.startedAt.Add(deadline))
+		if remaining < 0 {
+			remaining = 0
+		}
+		s.drawTimer = time.AfterFunc(remaining, s.revealWinnersAtDeadline)
+	}
+}
+
+// currentValidationRules returns the rules the bets are validated against.
+func (s *Server) currentValidationRules() ValidationRules {
+	s.settingsLock.Lock()
+	defer s.settingsLock.Unlock()
+	return s.validationRules
+}
+
+// currentDuplicatePolicy returns the policy applied to duplicated bets.
+func (s *Server) currentDuplicatePolicy() string {
+	s.settingsLock.Lock()
+	defer s.settingsLock.Unlock()
+	return s.duplicatePolicy
+}
+
+// currentWinnersPageSize returns the maximum amount of winners per page.
+func (s *Server) currentWinnersPageSize() int {
+	s.settingsLock.Lock()
+	defer s.settingsLock.Unlock()
+	return s.winnersPageSize
+}
+
+// currentShutdownTimeout returns how long GracefulShutdown waits for the
+// handlers in progress.
+func (s *Server) currentShutdownTimeout() time.Duration {
+	s.settingsLock.Lock()
+	defer s.settingsLock.Unlock()
+	return s.shutdownTimeout
+}
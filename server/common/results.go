@@ -0,0 +1,171 @@
+package common
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+)
+
+// resultsFilePath is the file where the results of the draw are kept until
+// the contest is archived.
+const resultsFilePath = "./results.csv"
+
+// StoreResults persists the prize of every winning bet of the draw, grouped
+// by the agencies that took part in it, replacing any previous results.
+// Agencies without winners are stored with an empty row so that they are not
+// mistaken for absent ones. Each row keeps the ID of the winning bet, so that
+// its payout can be restored as it was awarded.
+// Not thread-safe/process-safe.
+func StoreResults(agencies []int, prizes []Prize) error {
+	tmpPath := resultsFilePath + ".tmp"
+	file, err_creating := os.Create(tmpPath)
+	if err_creating != nil {
+		return err_creating
+	}
+
+	prizesPerAgency := map[int][]Prize{}
+	for _, prize := range prizes {
+		prizesPerAgency[prize.Bet.Agency] = append(prizesPerAgency[prize.Bet.Agency], prize)
+	}
+	agencies = append([]int(nil), agencies...)
+	sort.Ints(agencies)
+
+	writer := csv.NewWriter(file)
+	for _, agency := range agencies {
+		rows := [][]string{{strconv.Itoa(agency), "", "", ""}}
+		if len(prizesPerAgency[agency]) > 0 {
+			rows = nil
+		}
+		for _, prize := range prizesPerAgency[agency] {
+			rows = append(rows, []string{strconv.Itoa(agency), prize.Bet.Document, strconv.FormatInt(prize.Payout, 10), prize.Bet.ID})
+		}
+		if err_writing := writer.WriteAll(rows); err_writing != nil {
+			file.Close()
+			return err_writing
+		}
+	}
+	if err_syncing := file.Sync(); err_syncing != nil {
+		file.Close()
+		return err_syncing
+	}
+	if err_closing := file.Close(); err_closing != nil {
+		return err_closing
+	}
+	// The rename makes the new results visible all at once, so a crash in
+	// the middle of the write never leaves a partial results table.
+	return os.Rename(tmpPath, resultsFilePath)
+}
+
+// LoadResults loads the winners of every agency that took part in the draw,
+// in the order they were stored, and the payout awarded to each winning bet
+// by bet ID. Returns an error satisfying os.IsNotExist if the draw was not
+// performed or the contest was archived.
+// Not thread-safe/process-safe.
+func LoadResults() (map[int][]common.Winner, map[string]int64, error) {
+	file, err_opening := os.Open(resultsFilePath)
+	if err_opening != nil {
+		return nil, nil, err_opening
+	}
+	defer file.Close()
+
+	records, err_reading := csv.NewReader(file).ReadAll()
+	if err_reading != nil {
+		return nil, nil, err_reading
+	}
+	results := map[int][]common.Winner{}
+	payouts := map[string]int64{}
+	for _, row := range records {
+		if len(row) != 4 {
+			return nil, nil, fmt.Errorf("invalid results row: %v", row)
+		}
+		agency, err_agency := strconv.Atoi(row[0])
+		if err_agency != nil {
+			return nil, nil, err_agency
+		}
+		if row[1] == "" {
+			results[agency] = nil
+			continue
+		}
+		payout, err_payout := strconv.ParseInt(row[2], 10, 64)
+		if err_payout != nil {
+			return nil, nil, err_payout
+		}
+		results[agency] = append(results[agency], common.Winner{Document: row[1], Payout: payout})
+		payouts[row[3]] = payout
+	}
+	return results, payouts, nil
+}
+
+// ArchiveResults moves the results table aside, keeping it under a name that
+// records when the contest was archived. Returns the new path.
+// Not thread-safe/process-safe.
+func ArchiveResults(now time.Time) (string, error) {
+	archivedPath := fmt.Sprintf("%s.%s", resultsFilePath, now.UTC().Format("20060102T150405Z"))
+	if err_renaming := os.Rename(resultsFilePath, archivedPath); err_renaming != nil {
+		return "", err_renaming
+	}
+	return archivedPath, nil
+}
+
+// Archive closes the contest: the results table is moved aside and the
+// agencies can no longer ask for their winners.
+func (s *Server) Archive() error {
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	if !s.winnerRevealed {
+		return fmt.Errorf("draw not performed yet")
+	}
+	if s.archived {
+		return fmt.Errorf("contest already archived")
+	}
+	archivedPath, err_archiving := ArchiveResults(time.Now())
+	if err_archiving != nil && !os.IsNotExist(err_archiving) {
+		return err_archiving
+	}
+	s.archived = true
+	s.results = map[int][]common.Winner{}
+	log.Info("archivar_concurso", "success", logger.F("archivo", archivedPath))
+	return nil
+}
+
+// restoreResults resumes a contest whose draw was performed by a previous
+// run, taking the winners from the results table. The agencies in the table
+// that are not configured were registered at runtime, so they are registered
+// again. The stored bets get back the payouts they were awarded, by bet ID,
+// so that lookups keep working even if the prize rules changed since.
+func (s *Server) restoreResults(results map[int][]common.Winner, payouts map[string]int64, bets []Bet) {
+	s.results = results
+	s.winnerRevealed = true
+	for agency := range results {
+		if s.registry.IsRegistered(agency) {
+			continue
+		}
+		if err_registering := s.registry.Register(agency); err_registering != nil {
+			log.Error("restaurar_sorteo", "fail", logger.F("agency", agency), logger.F("error", err_registering))
+			continue
+		}
+		log.Info("register_agency", "success", logger.F("agency", agency))
+	}
+	for _, agency := range s.registry.Agencies() {
+		if _, tookPart := results[agency]; !tookPart {
+			s.absentAgencies[agency] = true
+			continue
+		}
+		s.registry.MarkFinished(agency)
+		s.agenciesWaiting[agency] = true
+	}
+
+	for _, bet := range bets {
+		if payout, won := payouts[bet.ID]; won {
+			s.drawPrizes[newBetKey(bet)] = Prize{Bet: bet, Payout: payout}
+		}
+	}
+	s.checkResultsDelivered()
+	log.Info("restaurar_sorteo", "success", logger.F("agencias", len(results)))
+}
@@ -3,259 +3,765 @@ package common
 import (
 	"fmt"
 	"net"
+	"os"
+	"sort"
 	"strconv"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
-	"github.com/op/go-logging"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+	metrics "github.com/7574-sistemas-distribuidos/docker-compose-init/metrics/common"
 )
 
-var log = logging.MustGetLogger("log")
+var log = logger.New()
 
 type Server struct {
 	listener           net.Listener
-	numberOfAgencies   int
+	registry           *AgencyRegistry
 	running            bool
 	runningLock        sync.Mutex
-	clientsConn        map[string]net.Conn
-	lockClientsConn    sync.Mutex
-	agenciesWaiting    map[int]string
+	connections        *ConnectionRegistry
+	agenciesWaiting    map[int]bool
+	results            map[int][]common.Winner
+	archived           bool
+	absentAgencies     map[int]bool
 	winnerRevealed     bool
 	lockWinnerRevealed sync.Mutex
 	betsLock           sync.Mutex
+	betsByID           map[string]Bet
+	receiptKey         []byte
+	prizeRules         PrizeRules
+	rejectedBets       map[int]int
+	drawPrizes         map[betKey]Prize
+	statsLock          sync.Mutex
 	wg                 sync.WaitGroup
+	drawDeadline       time.Duration
+	validationRules    ValidationRules
+	duplicatePolicy    string
+	duplicates         *DuplicateDetector
+	drawTimer          *time.Timer
+	winnersPageSize    int
+	lifecyclePolicy    string
+	resultsGracePeriod time.Duration
+	resultsDelivered   chan struct{}
+	deliveredOnce      sync.Once
+	closed             chan struct{}
+	closeOnce          sync.Once
+	metrics            *serverMetrics
+	config             ServerConfig
+	settingsLock       sync.Mutex
+	startedAt          time.Time
+	handlerSlots       chan struct{}
+	shutdownTimeout    time.Duration
+	runDone            chan struct{}
+	rateLimiter        *RateLimiter
 }
 
+// DefaultWinnersPageSize is the maximum amount of winners sent in each page
+// when the configuration does not set one. Pages are cut earlier if their
+// frame would exceed common.MaxFrameSize.
+const DefaultWinnersPageSize = 1000
+
+// ServerConfig holds the parameters needed to start a Server.
+// IP and Port are the address the server listens on; an empty IP listens
+// on every interface. ListenBacklog is the maximum amount of pending
+// connections; the system default is used when it is zero.
+// LogLevel and LogFormat are how the binary logs; the Server itself only
+// validates them.
+// Agencies lists the IDs of the agencies expected in the contest; more
+// can be added at runtime through RegisterAgency.
+// DrawDeadline is measured from the moment Run is called; once it passes
+// the draw is performed with the agencies that already finished. A zero
+// DrawDeadline waits for every agency indefinitely.
+// MinAge is the minimum age, in years, a bettor must have.
+// DuplicatePolicy is one of the DuplicatePolicy* constants and defaults to
+// DuplicatePolicyFlag.
+// ReceiptKey is the secret used to sign the receipts of the stored bets;
+// receipts are sent unsigned when it is empty.
+// PrizeRules sets how the stakes are paid out; if no tiers are given,
+// DefaultPrizeRules is used.
+// WinnersPageSize is the maximum amount of winners sent in each page of
+// the answer to a winners request; DefaultWinnersPageSize if not set. A page
+// is cut earlier if its frame would exceed common.MaxFrameSize.
+// LifecyclePolicy is one of the LifecyclePolicy* constants and defaults to
+// LifecyclePolicyExit; ResultsGracePeriod is only used by
+// LifecyclePolicyGracePeriod.
+// MaxConnections is the maximum amount of connections handled at the same
+// time; the rest wait in the listen backlog. Zero means no limit.
+// RateLimit is the amount of messages per second each agency can send, in
+// bursts of up to RateBurst; the rest are answered with a retryable error.
+// A zero RateLimit means no limit.
+// ShutdownTimeout is how long GracefulShutdown waits for the handlers in
+// progress before closing their connections; they are closed right away
+// when it is zero.
+// AdminAddress and MetricsAddress are where the binary serves AdminHandler
+// and MetricsHandler; they are disabled when empty.
 type ServerConfig struct {
-	Port             int
-	NumberOfAgencies int
+	IP                 string
+	Port               int
+	ListenBacklog      int
+	LogLevel           string
+	LogFormat          string
+	Agencies           []int
+	DrawDeadline       time.Duration
+	MinAge             int
+	DuplicatePolicy    string
+	ReceiptKey         string
+	PrizeRules         PrizeRules
+	WinnersPageSize    int
+	LifecyclePolicy    string
+	ResultsGracePeriod time.Duration
+	MaxConnections     int
+	RateLimit          float64
+	RateBurst          int
+	ShutdownTimeout    time.Duration
+	AdminAddress       string
+	MetricsAddress     string
 }
 
 func NewServer(config ServerConfig) (*Server, error) {
-	addr := fmt.Sprintf(":%d", config.Port)
-	listener, err := net.Listen("tcp", addr)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(config.IP, strconv.Itoa(config.Port))
+	listener, err := listenTCP(addr, config.ListenBacklog)
 	if err != nil {
 		return nil, err
 	}
 	server := &Server{
-		listener:         listener,
-		running:          true,
-		winnerRevealed:   false,
-		agenciesWaiting:  map[int]string{},
-		numberOfAgencies: config.NumberOfAgencies,
-		clientsConn:      map[string]net.Conn{},
+		listener:           listener,
+		running:            true,
+		winnerRevealed:     false,
+		agenciesWaiting:    map[int]bool{},
+		results:            map[int][]common.Winner{},
+		absentAgencies:     map[int]bool{},
+		registry:           NewAgencyRegistry(config.Agencies),
+		connections:        NewConnectionRegistry(),
+		drawDeadline:       config.DrawDeadline,
+		validationRules:    ValidationRules{MinAge: config.MinAge},
+		duplicatePolicy:    config.DuplicatePolicy,
+		duplicates:         NewDuplicateDetector(),
+		betsByID:           map[string]Bet{},
+		receiptKey:         []byte(config.ReceiptKey),
+		prizeRules:         config.PrizeRules,
+		rejectedBets:       map[int]int{},
+		drawPrizes:         map[betKey]Prize{},
+		winnersPageSize:    config.WinnersPageSize,
+		lifecyclePolicy:    config.LifecyclePolicy,
+		resultsGracePeriod: config.ResultsGracePeriod,
+		resultsDelivered:   make(chan struct{}),
+		closed:             make(chan struct{}),
+		metrics:            newServerMetrics(),
+		config:             config,
+		rateLimiter:        NewRateLimiter(config.RateLimit, config.RateBurst),
+		shutdownTimeout:    config.ShutdownTimeout,
+		runDone:            make(chan struct{}),
+	}
+	if config.MaxConnections > 0 {
+		server.handlerSlots = make(chan struct{}, config.MaxConnections)
+	}
+	if len(server.prizeRules.TierSplits) == 0 {
+		server.prizeRules = DefaultPrizeRules
+	}
+	if server.winnersPageSize <= 0 {
+		server.winnersPageSize = DefaultWinnersPageSize
+	}
+	if server.lifecyclePolicy == "" {
+		server.lifecyclePolicy = LifecyclePolicyExit
+	}
+	if server.duplicatePolicy == "" {
+		server.duplicatePolicy = DuplicatePolicyFlag
+	}
+
+	// Bets stored by a previous run still count when looking for duplicates.
+	storedBets, err := LoadBets()
+	if err != nil && !os.IsNotExist(err) {
+		listener.Close()
+		return nil, err
+	}
+	server.duplicates.Record(storedBets)
+	for _, bet := range storedBets {
+		if bet.ID != "" {
+			server.betsByID[bet.ID] = bet
+		}
+	}
+	rejected, err := LoadRejections()
+	if err != nil && !os.IsNotExist(err) {
+		listener.Close()
+		return nil, err
+	}
+	if err == nil {
+		server.rejectedBets = rejected
+	}
+
+	// If a previous run already performed the draw, its results are served
+	// again until the contest is archived.
+	results, payouts, err := LoadResults()
+	if err != nil && !os.IsNotExist(err) {
+		listener.Close()
+		return nil, err
+	}
+	if err == nil {
+		server.restoreResults(results, payouts, storedBets)
 	}
 	return server, nil
 }
 
 func (s *Server) Run() {
+	s.lockWinnerRevealed.Lock()
+	s.startedAt = time.Now()
+	if s.drawDeadline > 0 {
+		s.drawTimer = time.AfterFunc(s.drawDeadline, s.revealWinnersAtDeadline)
+	}
+	s.lockWinnerRevealed.Unlock()
 	for s.IsRunning() {
-		conn, ip, err := s.acceptNewConnection()
+		if !s.acquireHandlerSlot() {
+			break
+		}
+		conn, err := s.acceptNewConnection()
 		if err != nil {
+			s.releaseHandlerSlot()
 			if !s.IsRunning() {
-				log.Infof("action: accepted connection fail for quitting | result: success")
-				return
+				log.Info("accepted connection fail for quitting", "success")
+				break
 			}
-			log.Errorf("action: accept_connections | result: fail | error: %v", err)
+			log.Error("accept_connections", "fail", logger.F("error", err))
 			continue
 		}
 		s.wg.Add(1)
-		go s.handleClientConnection(conn, ip)
+		go s.handleClientConnection(s.connections.Add(conn))
 
 		s.canRevealWinners()
 	}
 	s.wg.Wait()
+	close(s.runDone)
 }
 
 // handleClientConnection processes the client connection by reading the message,
 // parsing the bets, storing them, and sending a confirmation back.
-func (s *Server) handleClientConnection(clientConn net.Conn, ip string) {
+func (s *Server) handleClientConnection(clientConn *TrackedConn) {
 	defer s.wg.Done()
-	s.lockClientsConn.Lock()
-	s.clientsConn[ip] = clientConn
-	s.lockClientsConn.Unlock()
-	// Ensure the connection is closed at the end.
+	defer s.releaseHandlerSlot()
+	// Ensure the connection is closed at the end, unless it was already
+	// closed through the registry.
 	defer func() {
-		s.lockClientsConn.Lock()
-		if s.clientsConn[ip] != nil {
-			s.clientsConn[ip].Close()
-			delete(s.clientsConn, ip)
-			log.Infof("action: close_connection of client| result: success")
+		if s.connections.Remove(clientConn) {
+			log.Info("close_connection of client", "success")
 		}
-		s.lockClientsConn.Unlock()
 	}()
 
 	msgStr, err_reading_msg := common.ReadMessage(clientConn)
 	if err_reading_msg != nil {
 		if s.IsRunning() {
-			log.Infof("action: receive_message | result: fail | error: %v", err_reading_msg)
+			log.Info("receive_message", "fail", logger.F("error", err_reading_msg))
 		}
 		return
 	}
+	s.metrics.framesRead.Inc()
+	if !s.IsRunning() {
+		s.sendError(clientConn, common.ReasonShuttingDown)
+		return
+	}
+	if agency, identified := messageAgency(msgStr); identified {
+		clientConn.SetAgency(agency)
+		if !s.allowMessage(clientConn, agency) {
+			return
+		}
+	}
 
-	if strings.Contains(msgStr, "Winners, please?") {
-		s.handleAgencyWaitingMessage(clientConn, msgStr)
-	} else {
+	if agency, args, isRequest := common.ParseRequest(msgStr, common.WinnersRequest); isRequest {
+		clientConn.SetOperation(OperationWinners)
+		s.handleAgencyWaitingMessage(clientConn, agency, args)
+	} else if agency, _, isRequest := common.ParseRequest(msgStr, common.FinishedRequest); isRequest {
+		clientConn.SetOperation(OperationFinished)
+		s.handleFinishedMessage(clientConn, agency)
+	} else if _, _, isRequest := common.ParseRequest(msgStr, common.PingRequest); isRequest {
+		clientConn.SetOperation(OperationPing)
+		s.handlePingMessage(clientConn)
+	} else if agency, args, isRequest := common.ParseRequest(msgStr, common.LookupRequest); isRequest {
+		clientConn.SetOperation(OperationLookup)
+		s.handleLookupMessage(clientConn, agency, args)
+	} else if agency, args, isRequest := common.ParseRequest(msgStr, common.CancelBetRequest); isRequest {
+		clientConn.SetOperation(OperationCancelBet)
+		s.handleCancelBetMessage(clientConn, agency, args)
+	} else if agency, args, isRequest := common.ParseRequest(msgStr, common.AmendBetRequest); isRequest {
+		clientConn.SetOperation(OperationAmendBet)
+		s.handleAmendBetMessage(clientConn, agency, args)
+	} else if msgType, _ := common.ParseMessage(msgStr); msgType == common.BetsMessage {
+		clientConn.SetOperation(OperationStoreBets)
 		s.handleStoreBetsMessage(clientConn, msgStr)
+	} else {
+		log.Error("receive_message", "fail", logger.F("error", "unknown message type"), logger.F("tipo", msgType))
+		s.sendError(clientConn, fmt.Sprintf("unknown message type %q", msgType))
 	}
 }
 
+// handleStoreBetsMessage stores a batch of bets, one CSV record per bet (see
+// common.BatchMessage), and answers which ones were stored and which
+// rejected. Rejections are counted for the agency that sent the batch, the
+// one of its first bet, whatever the agency of the rejected bets says.
 func (s *Server) handleStoreBetsMessage(clientConn net.Conn, msgStr string) {
 	var betList []Bet
-	error_in_bets := false
-	betsSplit := strings.Split(msgStr, ";")
-	for _, bet := range betsSplit {
-		betInfo := strings.Split(bet, ",")
+	var indexes []int
+	var rejections []common.BetRejection
+	unknownAgency := 0
+	// 0, which is never registered, if the batch does not start with an agency
+	agency, _ := messageAgency(msgStr)
+	entries := common.ParseBatch(msgStr)
+	s.metrics.batchSize.Observe(float64(len(entries)))
+	for i, entry := range entries {
+		betInfo := entry.Fields
+		if entry.Err != nil {
+			rejections = s.rejectBet(rejections, i, agency, ReasonInvalidFormat, entry.Err)
+			continue
+		}
 		if len(betInfo) < 6 {
-			error_in_bets = true
+			rejections = s.rejectBet(rejections, i, agency, ReasonInvalidFormat, fmt.Errorf("expected 6 fields, got %d", len(betInfo)))
 			continue
 		}
 		newBet, err_creating_bet := NewBet(betInfo[0], betInfo[1], betInfo[2], betInfo[3], betInfo[4], betInfo[5])
+		if err_creating_bet == nil && len(betInfo) > 6 {
+			newBet.Amount, err_creating_bet = parseStake(betInfo[6])
+		}
 		if err_creating_bet != nil {
-			if s.IsRunning() {
-				log.Errorf("action: create_bet | result: fail | error: %v", err_creating_bet)
-				error_in_bets = true
-				continue
-			} else {
+			if !s.IsRunning() {
 				return
 			}
+			rejections = s.rejectBet(rejections, i, agency, ReasonInvalidFormat, err_creating_bet)
+			continue
+		}
+		if !s.registry.IsRegistered(newBet.Agency) {
+			rejections = s.rejectBet(rejections, i, agency, ReasonUnknownAgency, fmt.Errorf("agency %d not registered", newBet.Agency))
+			unknownAgency = newBet.Agency
+			continue
+		}
+		if err_validating := ValidateBet(newBet, s.currentValidationRules()); err_validating != nil {
+			rejections = s.rejectBet(rejections, i, agency, validationReason(err_validating), err_validating)
+			continue
 		}
 		betList = append(betList, newBet)
+		indexes = append(indexes, i)
+	}
+	if len(betList) == 0 && unknownAgency != 0 {
+		s.sendError(clientConn, fmt.Sprintf("unknown agency %d", unknownAgency))
+		return
+	}
+	// The draw lock is held while storing so that no bet can slip in
+	// between the draw loading the bets and marking itself as done.
+	var err_store_bets error
+	s.lockWinnerRevealed.Lock()
+	drawClosed := s.winnerRevealed
+	if !drawClosed {
+		betList, indexes, rejections = s.filterDuplicates(agency, betList, indexes, rejections)
+		for i := range betList {
+			betList[i].ID = newBetID()
+		}
+		s.betsLock.Lock()
+		storeStart := time.Now()
+		err_store_bets = StoreBets(betList)
+		s.metrics.storeLatency.Observe(time.Since(storeStart).Seconds())
+		if err_store_bets == nil {
+			for _, bet := range betList {
+				s.betsByID[bet.ID] = bet
+				s.metrics.betsStored.Inc(strconv.Itoa(bet.Agency))
+			}
+			s.recordRejections(agency, len(rejections))
+		}
+		s.betsLock.Unlock()
+		if err_store_bets == nil {
+			s.duplicates.Record(betList)
+		}
+	}
+	s.lockWinnerRevealed.Unlock()
+	if drawClosed {
+		s.rejectLateBets(clientConn, betList)
+		return
 	}
-	s.betsLock.Lock()
-	err_store_bets := StoreBets(betList)
-	s.betsLock.Unlock()
 	if err_store_bets != nil {
 		if s.IsRunning() {
-			log.Errorf("action: store_bets | result: fail | error: %v", err_store_bets)
+			log.Error("store_bets", "fail", logger.F("error", err_store_bets))
 		}
 		return
 	}
 
-	if error_in_bets {
-		log.Errorf("action: apuesta_recibida | result: fail | cantidad: %d", len(betList))
+	if len(rejections) > 0 {
+		log.Error("apuesta_recibida", "fail", logger.F("cantidad", len(betList)), logger.F("rechazadas", len(rejections)))
 	} else {
-		log.Infof("action: apuesta_recibida | result: success | cantidad: %d", len(betList))
+		log.Info("apuesta_recibida", "success", logger.F("cantidad", len(betList)))
 	}
 
-	msgServer := fmt.Sprintf("%d apuestas almacenadas", len(betList))
-	err_sending_msg := common.SendMessage(clientConn, msgServer)
+	receipts := make([]common.BetReceipt, 0, len(betList))
+	for i, bet := range betList {
+		receipts = append(receipts, common.BetReceipt{Index: indexes[i], BetID: bet.ID, Signature: s.signReceipt(bet)})
+	}
+	msgServer := common.BatchAck{Stored: len(betList), Receipts: receipts, Rejections: rejections}.Encode()
+	err_sending_msg := s.sendMessage(clientConn, msgServer)
 	if err_sending_msg != nil {
 		if s.IsRunning() {
-			log.Errorf("action: sending server message | result: fail | error: %v", err_sending_msg)
+			log.Error("sending server message", "fail", logger.F("error", err_sending_msg))
 		}
 	} else {
-		log.Infof("action: sending server message | result: success | msg_server: %s", msgServer)
+		log.Info("sending server message", "success", logger.F("msg_server", msgServer))
 	}
 }
 
-func (s *Server) handleAgencyWaitingMessage(clientConn net.Conn, msgStr string) {
-	msgSplit := strings.Split(msgStr, ",")
-	agency, err_convert := strconv.Atoi(msgSplit[0])
+// handleAgencyWaitingMessage answers a winners request. Before the draw the
+// agency is marked as finished; after it, the winners of the agency are sent
+// one page at a time, starting at the continuation token given in args.
+// Winners can be asked for again until the contest is archived.
+func (s *Server) handleAgencyWaitingMessage(clientConn net.Conn, agencyStr string, args []string) {
+	agency, err_convert := strconv.Atoi(agencyStr)
 
 	if err_convert != nil {
-		log.Errorf("action: convert_agency | result: fail | error: %v", err_convert)
+		log.Error("convert_agency", "fail", logger.F("error", err_convert))
 		return
 	}
+	if !s.registry.IsRegistered(agency) {
+		log.Error("waiting agency", "fail", logger.F("agency", agency), logger.F("error", "unknown agency"))
+		s.sendError(clientConn, fmt.Sprintf("unknown agency %d", agency))
+		return
+	}
+	s.metrics.winnersQueries.Inc(strconv.Itoa(agency))
 	msg := ""
 	s.lockWinnerRevealed.Lock()
-	if s.winnerRevealed {
-		msg = s.agenciesWaiting[agency]
-		if len(msg) > 0 {
-			msg = msg[0 : len(msg)-1]
+	if s.archived {
+		msg = common.ErrorMessage("contest archived")
+		log.Info("send winners agency", "fail", logger.F("agency", agency), logger.F("error", "contest archived"))
+	} else if s.winnerRevealed && s.absentAgencies[agency] {
+		msg = common.ErrorMessage(fmt.Sprintf("agency %d absent from draw", agency))
+		log.Info("send winners agency", "fail", logger.F("agency", agency), logger.F("error", "absent from draw"))
+	} else if s.winnerRevealed {
+		token := ""
+		if len(args) > 0 {
+			token = args[0]
+		}
+		page, err_paging := s.winnersPage(agency, token)
+		if err_paging != nil {
+			msg = common.ErrorMessage(err_paging.Error())
+			log.Error("send winners agency", "fail", logger.F("agency", agency), logger.F("error", err_paging))
+		} else {
+			msg = page.Encode()
+			log.Info("send winners agency", "success", logger.F("agency", agency), logger.F("ganadores", len(page.Winners)), logger.F("siguiente", page.Next))
+			if page.Next == "" {
+				s.markResultsDelivered(agency)
+			}
 		}
-		log.Infof("action: send winners agency | result: success | agency: %d", agency)
-		delete(s.agenciesWaiting, agency)
 	} else {
-		msg = "No winners yet"
-		s.agenciesWaiting[agency] = ""
-		log.Infof("action: waiting agency | result: success | agency: %d", agency)
+		msg = common.NoWinnersYet
+		s.markAgencyFinished(agency)
+		log.Info("waiting agency", "success", logger.F("agency", agency))
 	}
 	s.lockWinnerRevealed.Unlock()
 
-	err_sending_msg := common.SendMessage(clientConn, msg)
+	err_sending_msg := s.sendMessage(clientConn, msg)
 	if err_sending_msg != nil {
 		if s.IsRunning() {
-			log.Errorf("action: send client message | result: fail | error: %v | msg_server:", err_sending_msg, msg)
+			log.Error("send client message", "fail", logger.F("error", err_sending_msg), logger.F("msg_server", msg))
 		}
 	} else {
-		log.Infof("action: send client message | result: success | msg_server: %s", msg)
+		log.Info("send client message", "success", logger.F("msg_server", msg))
 	}
+}
 
-	s.lockWinnerRevealed.Lock()
-	agenciesWaiting := len(s.agenciesWaiting)
-	s.lockWinnerRevealed.Unlock()
-	if agenciesWaiting == 0 && s.IsRunning() {
-		s.GracefulShutdown()
+// winnersPage returns the page of the winners of the agency that starts at
+// the continuation token, which is the position of its first winner. An
+// empty token asks for the first page. A page holds up to the configured
+// page size of winners, as long as its frame fits in common.MaxFrameSize.
+// Must be called holding lockWinnerRevealed.
+func (s *Server) winnersPage(agency int, token string) (common.WinnersPage, error) {
+	winners := s.results[agency]
+	start := 0
+	if token != "" {
+		var err_convert error
+		start, err_convert = strconv.Atoi(token)
+		if err_convert != nil || start < 0 || start > len(winners) {
+			return common.WinnersPage{}, fmt.Errorf("invalid continuation token %q", token)
+		}
+	}
+	end := start + s.currentWinnersPageSize()
+	if end > len(winners) {
+		end = len(winners)
+	}
+	// the token is at most as long as the amount of winners
+	length := len(common.WinnersPage{Next: strconv.Itoa(len(winners))}.Encode())
+	for i := start; i < end; i++ {
+		entry := len(common.EncodeWinners(winners[i : i+1]))
+		if i > start {
+			entry++
+		}
+		if i > start && common.FrameSize(length+entry) > common.MaxFrameSize {
+			end = i
+			break
+		}
+		length += entry
+	}
+	if end >= len(winners) {
+		return common.WinnersPage{Winners: winners[start:]}, nil
+	}
+	return common.WinnersPage{Winners: winners[start:end], Next: strconv.Itoa(end)}, nil
+}
+
+// signReceipt signs the receipt of a stored bet so that the agency can prove
+// the bet was registered. Returns an empty signature if there is no key.
+func (s *Server) signReceipt(bet Bet) string {
+	if len(s.receiptKey) == 0 {
+		return ""
+	}
+	return common.ReceiptSignature(s.receiptKey, bet.ID, strconv.Itoa(bet.Agency), bet.Document, strconv.Itoa(bet.Number), bet.Amount)
+}
+
+// rejectBet logs why the bet at position index of a batch sent by the agency
+// was rejected and adds it to the rejections that are sent back. Only the
+// rejections of registered agencies are labelled by agency id; the rest go
+// under unknownAgencyLabel, so that made-up agency ids do not add series
+// that never go away.
+func (s *Server) rejectBet(rejections []common.BetRejection, index int, agency int, reason string, err error) []common.BetRejection {
+	log.Error("apuesta_rechazada", "fail", logger.F("agency", agency), logger.F("indice", index), logger.F("motivo", reason), logger.F("error", err))
+	label := unknownAgencyLabel
+	if s.registry.IsRegistered(agency) {
+		label = strconv.Itoa(agency)
+	}
+	s.metrics.betsRejected.Inc(label, reason)
+	return append(rejections, common.BetRejection{Index: index, Reason: reason})
+}
+
+// filterDuplicates applies the duplicate policy to the bets of a batch, whose
+// positions within the batch are given by indexes. It returns the bets that
+// must be stored along with their positions, and the rejections extended
+// with the rejected duplicates. agency is the one that sent the batch.
+func (s *Server) filterDuplicates(agency int, bets []Bet, indexes []int, rejections []common.BetRejection) ([]Bet, []int, []common.BetRejection) {
+	policy := s.currentDuplicatePolicy()
+	if policy == DuplicatePolicyAccept {
+		return bets, indexes, rejections
+	}
+	var accepted []Bet
+	var acceptedIndexes []int
+	for i, bet := range bets {
+		reason := s.duplicates.Find(bet, accepted)
+		if reason == "" {
+			accepted = append(accepted, bet)
+			acceptedIndexes = append(acceptedIndexes, indexes[i])
+			continue
+		}
+		if policy == DuplicatePolicyReject {
+			rejections = s.rejectBet(rejections, indexes[i], agency, reason, fmt.Errorf("document %s already used", bet.Document))
+			continue
+		}
+		log.Warning("apuesta_marcada", "success", logger.F("agency", bet.Agency), logger.F("documento", bet.Document), logger.F("motivo", reason))
+		s.duplicates.Flag(bet, reason)
+		accepted = append(accepted, bet)
+		acceptedIndexes = append(acceptedIndexes, indexes[i])
 	}
+	sort.Slice(rejections, func(i, j int) bool {
+		return rejections[i].Index < rejections[j].Index
+	})
+	return accepted, acceptedIndexes, rejections
+}
+
+// logDuplicatesReport logs every document flagged during the contest.
+func (s *Server) logDuplicatesReport() {
+	report := s.duplicates.Report()
+	for _, flagged := range report {
+		log.Info("reporte_duplicados", "success", logger.F("documento", flagged.Document), logger.F("agencias", flagged.Agencies), logger.F("motivos", flagged.Reasons))
+	}
+	log.Info("reporte_duplicados", "success", logger.F("documentos_marcados", len(report)))
+}
+
+// rejectLateBets answers a batch that arrived after the draw with an
+// explicit error, pointing out when its agency was marked absent.
+func (s *Server) rejectLateBets(clientConn net.Conn, betList []Bet) {
+	reason := "draw closed, bets no longer accepted"
+	if len(betList) > 0 {
+		agency := betList[0].Agency
+		s.lockWinnerRevealed.Lock()
+		absent := s.absentAgencies[agency]
+		s.lockWinnerRevealed.Unlock()
+		if absent {
+			reason = fmt.Sprintf("draw closed, agency %d marked absent", agency)
+		}
+	}
+	log.Error("apuesta_recibida", "fail", logger.F("cantidad", len(betList)), logger.F("error", reason))
+	s.sendError(clientConn, reason)
+}
 
+// sendError answers the client with an error message.
+func (s *Server) sendError(clientConn net.Conn, reason string) {
+	s.sendReply(clientConn, common.ErrorMessage(reason))
+}
+
+// sendReply answers the client, logging if the message could not be sent.
+func (s *Server) sendReply(clientConn net.Conn, msg string) {
+	err_sending_msg := s.sendMessage(clientConn, msg)
+	if err_sending_msg != nil && s.IsRunning() {
+		log.Error("sending server message", "fail", logger.F("error", err_sending_msg))
+	}
+}
+
+// sendMessage sends a frame to the client, counting it if it was sent.
+func (s *Server) sendMessage(clientConn net.Conn, msg string) error {
+	err_sending_msg := common.SendMessage(clientConn, msg)
+	if err_sending_msg == nil {
+		s.metrics.framesWritten.Inc()
+		if msg == common.NoWinnersYet {
+			s.metrics.noWinnersYet.Inc()
+		}
+	}
+	return err_sending_msg
+}
+
+// RegisterAgency adds an agency to the contest at runtime. Agencies can
+// only be registered while the draw has not been performed yet.
+func (s *Server) RegisterAgency(agency int) error {
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	if s.winnerRevealed {
+		return fmt.Errorf("draw already performed")
+	}
+	if err := s.registry.Register(agency); err != nil {
+		return err
+	}
+	log.Info("register_agency", "success", logger.F("agency", agency))
+	return nil
 }
 
 func (s *Server) canRevealWinners() {
 	s.lockWinnerRevealed.Lock()
-	if !s.winnerRevealed && len(s.agenciesWaiting) == s.numberOfAgencies {
-		log.Infof("action: sorteo | result: success")
-		s.betsLock.Lock()
-		bets, err_loading_bets := LoadBets()
-		s.betsLock.Unlock()
-		if err_loading_bets != nil {
-			if s.IsRunning() {
-				log.Errorf("action: load_bets | result: fail | error: %v", err_loading_bets)
-			}
-			return
+	defer s.lockWinnerRevealed.Unlock()
+	if !s.winnerRevealed && s.registry.AllFinished() {
+		s.revealWinners()
+	}
+}
+
+// revealWinnersAtDeadline performs the draw when the draw deadline passes,
+// even if some of the agencies never asked for the winners.
+func (s *Server) revealWinnersAtDeadline() {
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	if s.winnerRevealed || !s.IsRunning() {
+		return
+	}
+	log.Info("draw_deadline", "success", logger.F("agencies_finished", len(s.agenciesWaiting)))
+	s.revealWinners()
+}
+
+// PerformDraw performs the draw right away, without waiting for the
+// agencies that did not finish sending their bets, which are marked absent.
+func (s *Server) PerformDraw() error {
+	s.lockWinnerRevealed.Lock()
+	defer s.lockWinnerRevealed.Unlock()
+	if s.winnerRevealed {
+		return fmt.Errorf("draw already performed")
+	}
+	log.Info("sorteo_manual", "success", logger.F("agencies_finished", len(s.agenciesWaiting)))
+	s.revealWinners()
+	return nil
+}
+
+// revealWinners performs the draw among the agencies that finished sending
+// their bets. Agencies that did not finish are marked as absent and their
+// bets are left out of the draw. Must be called holding lockWinnerRevealed.
+func (s *Server) revealWinners() {
+	log.Info("sorteo", "success")
+	s.logDuplicatesReport()
+	s.betsLock.Lock()
+	bets, err_loading_bets := LoadBets()
+	s.betsLock.Unlock()
+	if err_loading_bets != nil && !os.IsNotExist(err_loading_bets) {
+		if s.IsRunning() {
+			log.Error("load_bets", "fail", logger.F("error", err_loading_bets))
 		}
+		return
+	}
 
-		for _, bet := range bets {
-			if !s.IsRunning() {
-				break
-			}
-			if HasWon(bet) {
-				s.agenciesWaiting[bet.Agency] += fmt.Sprintf("%s;", bet.Document)
-			}
+	for _, agency := range s.registry.Missing() {
+		s.absentAgencies[agency] = true
+		log.Info("agency_absent", "success", logger.F("agency", agency))
+	}
+
+	var counted []Bet
+	for _, bet := range bets {
+		if !s.absentAgencies[bet.Agency] {
+			counted = append(counted, bet)
 		}
-		s.winnerRevealed = true
 	}
-	s.lockWinnerRevealed.Unlock()
+	pool, prizes := ComputePrizes(counted, s.prizeRules)
+	log.Info("pozo", "success",
+		logger.F("pozo", common.FormatAmount(pool)),
+		logger.F("porcentaje_casa", s.prizeRules.HousePercentage),
+		logger.F("ganadores", len(prizes)),
+	)
+
+	for agency := range s.agenciesWaiting {
+		s.results[agency] = nil
+	}
+	for _, prize := range prizes {
+		s.drawPrizes[newBetKey(prize.Bet)] = prize
+		winner := common.Winner{Document: prize.Bet.Document, Payout: prize.Payout}
+		s.results[prize.Bet.Agency] = append(s.results[prize.Bet.Agency], winner)
+	}
+	agencies := make([]int, 0, len(s.results))
+	for agency := range s.results {
+		agencies = append(agencies, agency)
+	}
+	if err_storing := StoreResults(agencies, prizes); err_storing != nil {
+		log.Error("store_results", "fail", logger.F("error", err_storing))
+	}
+	s.winnerRevealed = true
+	s.checkResultsDelivered()
 }
 
 // acceptNewConnection waits for a new client connection.
-func (s *Server) acceptNewConnection() (net.Conn, string, error) {
-	log.Infof("action: accept_connections | result: in_progress")
+func (s *Server) acceptNewConnection() (net.Conn, error) {
+	log.Info("accept_connections", "in_progress")
 	conn, err := s.listener.Accept()
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	remoteAddr := conn.RemoteAddr().String()
-	log.Infof("action: accept_connections | result: success | ip: %s", remoteAddr)
-	return conn, remoteAddr, nil
+	log.Info("accept_connections", "success", logger.F("ip", conn.RemoteAddr()))
+	s.metrics.connectionsAccepted.Inc()
+	return metrics.CountBytes(conn, s.metrics.bytesReceived, s.metrics.bytesSent), nil
 }
 
-// gracefulShutdown handles shutdown signals by closing the client connection
-// (if any) and the server listener, then exiting.
+// GracefulShutdown stops accepting connections and lets the handlers in
+// progress finish the frame they are processing, for up to the shutdown
+// timeout. Frames read after this point are answered with a "server
+// shutting down" error. The connections still open once the timeout passes
+// are closed.
 func (s *Server) GracefulShutdown() {
-	s.runningLock.Lock()
-	s.running = false
-	s.runningLock.Unlock()
-	log.Infof("action: graceful_shutdown | result: in_progress")
+	timeout := s.currentShutdownTimeout()
+	log.Info("graceful_shutdown", "in_progress", logger.F("timeout", timeout))
+	s.stopAccepting()
 
-	s.lockClientsConn.Lock()
-	for ip, conn := range s.clientsConn {
-		conn.Close()
-		s.clientsConn[ip] = nil
-		log.Infof("action: close_connection of client | result: success | ip: %v", ip)
+	if s.waitForHandlers(timeout) {
+		log.Info("drain", "success")
+	} else {
+		log.Warning("drain", "fail", logger.F("msg", "shutdown timeout exceeded, closing connections"))
+		for _, conn := range s.connections.CloseAll() {
+			log.Info("close_connection of client", "success", logger.F("ip", conn.RemoteAddr), logger.F("agency", conn.Agency), logger.F("operation", conn.Operation))
+		}
 	}
-	s.lockClientsConn.Unlock()
+	log.Info("graceful_shutdown", "success", logger.F("msg", "server closed gracefully"))
+}
 
-	if s.listener != nil {
-		err := s.listener.Close()
-		if err != nil {
-			log.Infof("action: listener.Close() finished | result: success| error: %v", err)
-		} else {
-			log.Infof("action: listener.Close() finished | result: success")
-		}
+// Connections returns the open client connections.
+func (s *Server) Connections() []ConnectionInfo {
+	return s.connections.List()
+}
+
+// CloseAgencyConnections closes the open connections of the agency and
+// returns them.
+func (s *Server) CloseAgencyConnections(agency int) []ConnectionInfo {
+	closed := s.connections.CloseAgency(agency)
+	for _, conn := range closed {
+		log.Info("close_connection of client", "success", logger.F("ip", conn.RemoteAddr), logger.F("agency", conn.Agency))
 	}
-	log.Infof("action: graceful_shutdown | result: success | msg: server closed gracefully")
+	return closed
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
 }
 
 func (s *Server) IsRunning() bool {
@@ -1,10 +1,15 @@
 package common
 
 import (
+	"crypto/rand"
 	"encoding/csv"
+	"encoding/hex"
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
 )
 
 // STORAGE_FILEPATH is the file where bets are stored.
@@ -13,17 +18,28 @@ const storageFilePath = "./bets.csv"
 // LOTTERY_WINNER_NUMBER is the simulated winner number in the lottery contest.
 const lotteryWinnerNumber = 7574
 
+// Operations recorded in the storage file after the bet fields. A row without
+// operation is a new bet; later rows with the same bet ID amend or cancel it.
+const (
+	operationAmend  = "modificada"
+	operationCancel = "cancelada"
+)
+
 // Bet represents a lottery bet registry.
 // agency must be passed as a string that can be converted to int,
 // birthdate must be in the format "YYYY-MM-DD",
 // number must be passed as a string that can be converted to int.
+// ID is assigned by the server when the bet is stored.
+// Amount is the optional stake of the bet, in cents.
 type Bet struct {
+	ID        string
 	Agency    int
 	FirstName string
 	LastName  string
 	Document  string
 	Birthdate time.Time
 	Number    int
+	Amount    int64
 }
 
 // NewBet creates a new Bet from string parameters.
@@ -36,13 +52,13 @@ func NewBet(agency, firstName, lastName, document, birthdate, number string) (Be
 
 	num, err := strconv.Atoi(number)
 	if err != nil {
-		log.Errorf("action: failed to parse number: %v | result: fail ", err)
+		log.Error("parse_number", "fail", logger.F("error", err))
 		return Bet{}, err
 	}
 
 	bd, err := time.Parse("2006-01-02", birthdate)
 	if err != nil {
-		log.Errorf("action: failed to parse birthdate: %v | result: fail ", err)
+		log.Error("parse_birthdate", "fail", logger.F("error", err))
 		return Bet{}, err
 	}
 
@@ -56,6 +72,24 @@ func NewBet(agency, firstName, lastName, document, birthdate, number string) (Be
 	}, nil
 }
 
+// parseStake parses the optional stake of a bet, e.g. "150.50", into cents.
+// An empty stake means the bet carries no amount.
+func parseStake(amount string) (int64, error) {
+	if amount == "" {
+		return 0, nil
+	}
+	return common.ParseAmount(amount)
+}
+
+// newBetID generates a random identifier for a bet.
+func newBetID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
 // HasWon checks whether a bet won the prize or not.
 func HasWon(bet Bet) bool {
 	return bet.Number == lotteryWinnerNumber
@@ -64,22 +98,52 @@ func HasWon(bet Bet) bool {
 // StoreBets persists the information of each bet in the storage file.
 // Not thread-safe/process-safe.
 func StoreBets(bets []Bet) error {
-	file, err_opening := os.OpenFile(storageFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	rows := make([][]string, 0, len(bets))
+	for _, bet := range bets {
+		rows = append(rows, betRow(bet, ""))
+	}
+	return appendRows(storageFilePath, rows)
+}
+
+// StoreBetAmendment records a new version of an already stored bet, which
+// replaces the previous one when loading the bets. The bet must have an ID.
+// Not thread-safe/process-safe.
+func StoreBetAmendment(bet Bet) error {
+	return appendRows(storageFilePath, [][]string{betRow(bet, operationAmend)})
+}
+
+// StoreBetCancellation records a tombstone for an already stored bet, which
+// is then left out when loading the bets. The bet must have an ID.
+// Not thread-safe/process-safe.
+func StoreBetCancellation(bet Bet) error {
+	return appendRows(storageFilePath, [][]string{betRow(bet, operationCancel)})
+}
+
+// betRow converts a bet to its row in the storage file.
+func betRow(bet Bet, operation string) []string {
+	return []string{
+		strconv.Itoa(bet.Agency),
+		bet.FirstName,
+		bet.LastName,
+		bet.Document,
+		bet.Birthdate.Format("2006-01-02"),
+		strconv.Itoa(bet.Number),
+		bet.ID,
+		operation,
+		strconv.FormatInt(bet.Amount, 10),
+	}
+}
+
+// appendRows appends the rows to the CSV file at path.
+func appendRows(path string, rows [][]string) error {
+	file, err_opening := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err_opening != nil {
 		return err_opening
 	}
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
-	for _, bet := range bets {
-		row := []string{
-			strconv.Itoa(bet.Agency),
-			bet.FirstName,
-			bet.LastName,
-			bet.Document,
-			bet.Birthdate.Format("2006-01-02"),
-			strconv.Itoa(bet.Number),
-		}
+	for _, row := range rows {
 		err_writing := writer.Write(row)
 		if err_writing != nil {
 			return err_writing
@@ -93,7 +157,9 @@ func StoreBets(bets []Bet) error {
 	return nil
 }
 
-// LoadBets loads all the bets from the storage file.
+// LoadBets loads all the bets from the storage file, in the order they were
+// first stored. Amended bets are returned in their latest version and
+// cancelled bets are left out.
 // Not thread-safe/process-safe.
 func LoadBets() ([]Bet, error) {
 	file, err_opening := os.Open(storageFilePath)
@@ -103,12 +169,14 @@ func LoadBets() ([]Bet, error) {
 	defer file.Close()
 
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
 	records, err_reading := reader.ReadAll()
 	if err_reading != nil {
 		return nil, err_reading
 	}
 
-	var bets []Bet
+	var bets []*Bet
+	positions := map[string]int{}
 	for _, row := range records {
 		if len(row) < 6 {
 			// Skip rows that do not have all required fields.
@@ -118,7 +186,41 @@ func LoadBets() ([]Bet, error) {
 		if err_creating_bet != nil {
 			return nil, err_creating_bet
 		}
-		bets = append(bets, bet)
+		operation := ""
+		if len(row) >= 8 {
+			bet.ID = row[6]
+			operation = row[7]
+		}
+		if len(row) >= 9 {
+			bet.Amount, err_creating_bet = strconv.ParseInt(row[8], 10, 64)
+			if err_creating_bet != nil {
+				return nil, err_creating_bet
+			}
+		}
+
+		position, stored := positions[bet.ID]
+		switch {
+		case bet.ID == "" || !stored:
+			if operation == operationCancel {
+				continue
+			}
+			if bet.ID != "" {
+				positions[bet.ID] = len(bets)
+			}
+			bets = append(bets, &bet)
+		case operation == operationCancel:
+			bets[position] = nil
+			delete(positions, bet.ID)
+		default:
+			bets[position] = &bet
+		}
+	}
+
+	var latest []Bet
+	for _, bet := range bets {
+		if bet != nil {
+			latest = append(latest, *bet)
+		}
 	}
-	return bets, nil
+	return latest, nil
 }
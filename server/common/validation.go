@@ -0,0 +1,90 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Reasons sent back to the agency for each rejected bet.
+const (
+	ReasonInvalidFormat      = "formato_invalido"
+	ReasonUnknownAgency      = "agencia_desconocida"
+	ReasonNumberOutOfRange   = "numero_fuera_de_rango"
+	ReasonInvalidDocument    = "documento_invalido"
+	ReasonEmptyName          = "nombre_vacio"
+	ReasonFutureBirthdate    = "nacimiento_futuro"
+	ReasonUnderage           = "menor_de_edad"
+	ReasonInvalidAmount      = "monto_invalido"
+	ReasonDuplicatedBet      = "apuesta_duplicada"
+	ReasonDuplicatedDocument = "documento_duplicado"
+)
+
+const minBetNumber = 0
+const maxBetNumber = 9999
+
+// maxBetAmount is the largest stake accepted, in cents.
+const maxBetAmount = 100000000
+
+// documentPattern matches the DNI numbers accepted in a bet.
+var documentPattern = regexp.MustCompile(`^[0-9]{7,8}$`)
+
+// ValidationRules holds the configurable parameters of the bet validation.
+// Now is used as the reference date for birthdates; if nil, time.Now is used.
+type ValidationRules struct {
+	MinAge int
+	Now    func() time.Time
+}
+
+// BetValidationError is returned when a bet breaks one of the rules.
+// Reason is one of the Reason* constants and is what the agency receives.
+type BetValidationError struct {
+	Reason string
+	Detail string
+}
+
+func (e *BetValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Detail)
+}
+
+// validationReason returns the reason to send back for an error returned by
+// ValidateBet, falling back to ReasonInvalidFormat if it does not carry one.
+func validationReason(err error) string {
+	var validationErr *BetValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Reason
+	}
+	return ReasonInvalidFormat
+}
+
+// ValidateBet checks the bet against the domain rules and returns a
+// *BetValidationError describing the first rule it breaks.
+func ValidateBet(bet Bet, rules ValidationRules) error {
+	if bet.Number < minBetNumber || bet.Number > maxBetNumber {
+		return &BetValidationError{ReasonNumberOutOfRange, fmt.Sprintf("number %d not in [%d, %d]", bet.Number, minBetNumber, maxBetNumber)}
+	}
+	if !documentPattern.MatchString(bet.Document) {
+		return &BetValidationError{ReasonInvalidDocument, fmt.Sprintf("document %q must have 7 or 8 digits", bet.Document)}
+	}
+	if strings.TrimSpace(bet.FirstName) == "" || strings.TrimSpace(bet.LastName) == "" {
+		return &BetValidationError{ReasonEmptyName, "first and last name are required"}
+	}
+
+	if bet.Amount < 0 || bet.Amount > maxBetAmount {
+		return &BetValidationError{ReasonInvalidAmount, fmt.Sprintf("stake %d not in [0, %d]", bet.Amount, maxBetAmount)}
+	}
+
+	now := time.Now()
+	if rules.Now != nil {
+		now = rules.Now()
+	}
+	if bet.Birthdate.After(now) {
+		return &BetValidationError{ReasonFutureBirthdate, fmt.Sprintf("birthdate %s is in the future", bet.Birthdate.Format("2006-01-02"))}
+	}
+	if bet.Birthdate.AddDate(rules.MinAge, 0, 0).After(now) {
+		return &BetValidationError{ReasonUnderage, fmt.Sprintf("bettor must be at least %d years old", rules.MinAge)}
+	}
+	return nil
+}
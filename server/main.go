@@ -1,125 +1,154 @@
 package main
 
 import (
-	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
-	"strings"
-	"sync"
 	"syscall"
 	"time"
 
+	logger "github.com/7574-sistemas-distribuidos/docker-compose-init/logger/common"
+	reload "github.com/7574-sistemas-distribuidos/docker-compose-init/reload/common"
 	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
-	"github.com/op/go-logging"
-	"github.com/spf13/viper"
 )
 
-var log = logging.MustGetLogger("log")
-
-// Config holds the configuration parameters.
-type Config struct {
-	Port          int
-	ListenBacklog int
-	LoggingLevel  string
-}
-
-func InitConfig() (*viper.Viper, error) {
-
-	v := viper.New()
-	v.AutomaticEnv()
-
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
-	v.SetEnvPrefix("server")
-	v.BindEnv("number_of_agencies")
-	v.BindEnv("default.server_port")
-	v.BindEnv("default.server_listen_backlog")
-	v.BindEnv("default.logging_level")
-
-	v.SetConfigFile("./config.ini")
-	if err := v.ReadInConfig(); err != nil {
-		fmt.Printf("Configuration could not be read from config file. Using env variables instead")
-	}
-
-	return v, nil
-}
-
-func InitLogger(logLevel string) error {
-	baseBackend := logging.NewLogBackend(os.Stdout, "", 0)
-	format := logging.MustStringFormatter(
-		`%{time:2006-01-02 15:04:05} %{level:.5s}     %{message}`,
-	)
-
-	backendFormatter := logging.NewBackendFormatter(baseBackend, format)
-	backendLeveled := logging.AddModuleLevel(backendFormatter)
-	logLevelCode, err := logging.LogLevel(logLevel)
-	if err != nil {
-		return err
-	}
-	backendLeveled.SetLevel(logLevelCode, "")
-	logging.SetBackend(backendLeveled)
-	return nil
-}
-
-func PrintConfig(v *viper.Viper) {
-	log.Infof("action: config | result: success | port: %d | listen_backlog: %d | logging_level: %s | number_of_agencies: %d",
-		v.GetInt("default.server_port"),
-		v.GetInt("default.server_listen_backlog"),
-		v.GetString("default.logging_level"),
-		v.GetInt("number_of_agencies"),
+var log = logger.New()
+
+// configPath is the file the configuration is read from, and reloaded from
+// on SIGHUP or whenever it changes.
+const configPath = "./config.ini"
+
+// PrintConfig Print all the configuration parameters of the program.
+// For debugging purposes only
+func PrintConfig(config common.ServerConfig) {
+	log.Info("config", "success",
+		logger.F("ip", config.IP),
+		logger.F("port", config.Port),
+		logger.F("listen_backlog", config.ListenBacklog),
+		logger.F("logging_level", config.LogLevel),
+		logger.F("log_format", config.LogFormat),
+		logger.F("agencies", config.Agencies),
+		logger.F("draw_deadline", config.DrawDeadline),
+		logger.F("min_age", config.MinAge),
+		logger.F("duplicate_policy", config.DuplicatePolicy),
+		logger.F("signed_receipts", config.ReceiptKey != ""),
+		logger.F("house_percentage", config.PrizeRules.HousePercentage),
+		logger.F("prize_tiers", config.PrizeRules.TierSplits),
+		logger.F("winners_page_size", config.WinnersPageSize),
+		logger.F("lifecycle_policy", config.LifecyclePolicy),
+		logger.F("results_grace_period", config.ResultsGracePeriod),
+		logger.F("max_connections", config.MaxConnections),
+		logger.F("rate_limit", config.RateLimit),
+		logger.F("rate_burst", config.RateBurst),
+		logger.F("shutdown_timeout", config.ShutdownTimeout),
+		logger.F("admin_address", config.AdminAddress),
+		logger.F("metrics_address", config.MetricsAddress),
 	)
 }
 
 func main() {
-	v, err := InitConfig()
+	serverConfig, err := common.LoadConfig(configPath)
 	if err != nil {
-		log.Criticalf("%s", err)
+		log.Fatalf("%s", err)
 	}
 
-	if err := InitLogger("INFO"); err != nil {
-		log.Criticalf("%s", err)
+	if err := logger.Init(serverConfig.LogLevel, serverConfig.LogFormat); err != nil {
+		log.Fatalf("%s", err)
 	}
 
-	PrintConfig(v)
+	PrintConfig(serverConfig)
 
-	serverConfig := common.ServerConfig{
-		Port:             v.GetInt("default.server_port"),
-		NumberOfAgencies: v.GetInt("number_of_agencies"),
-	}
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	finishChan := make(chan bool)
 	server, err := common.NewServer(serverConfig)
 	if err != nil {
-		log.Fatalf("action: start server | result: success | Failed to start server: %v", err)
+		log.Fatal("start server", "fail", logger.F("error", err))
 	}
-	go HandleSignals(server, &wg, finishChan)
-	server.Run()
-	if server.IsRunning() {
-		finishChan <- true
-	}
-	close(finishChan)
-	log.Infof("action: finish server | result: success ")
-	wg.Wait()
-	time.Sleep(1000 * time.Millisecond)
-}
-
-func HandleSignals(s *common.Server, wg *sync.WaitGroup, finishChan chan bool) {
-
-	defer wg.Done()
+	runFinished := make(chan struct{})
+	go func() {
+		server.Run()
+		close(runFinished)
+	}()
+	admin := startHTTPServer("admin_api", serverConfig.AdminAddress, server.AdminHandler())
+	metricsServer := startHTTPServer("metrics", serverConfig.MetricsAddress, server.MetricsHandler())
 
 	sigChannel := make(chan os.Signal, 1) // espera las signals
 	//crea un canal (chan) en Go que puede recibir valores del tipo os.Signal
 	//el 1 en make(chan os.Signal, 1) significa que es un canal con buffer de tamaño 1
-	signal.Notify(sigChannel, syscall.SIGTERM)
-	//escuche la señal SIGTERM del sistema operativo.
+	signal.Notify(sigChannel, syscall.SIGTERM, syscall.SIGINT)
+	//escuche las señales SIGTERM y SIGINT del sistema operativo.
 	//cuando SIGTERM ocurra, se enviará automáticamente al canal sigChannel
+	reloadChannel := make(chan os.Signal, 1)
+	signal.Notify(reloadChannel, syscall.SIGHUP)
+	configChanged := reload.WatchFile(configPath)
+	shutdownDue := server.ShutdownDue()
+waitLoop:
+	for {
+		select {
+		case <-reloadChannel:
+			log.Info("signal", "success", logger.F("signal", "SIGHUP"))
+			reloadConfig(server)
+		case <-configChanged:
+			reloadConfig(server)
+		case sig := <-sigChannel:
+			log.Info("signal", "success", logger.F("signal", reload.SignalName(sig)))
+			break waitLoop
+		case <-shutdownDue:
+			log.Info("lifecycle", "success", logger.F("policy", serverConfig.LifecyclePolicy))
+			break waitLoop
+		case <-runFinished:
+			break waitLoop
+		}
+	}
+	// El cierre se inicia siempre desde la goroutine principal, nunca desde
+	// un handler de conexión. Si el servidor ya se estaba drenando, igual se
+	// cierran las conexiones que sigan abiertas al vencer el plazo.
 	select {
-	case <-finishChan:
-		log.Infof("action: signal | result: success | signal: finish")
-	case <-sigChannel:
-		log.Infof("action: signal | result: success | signal: SIGTERM")
-		//Bloquea la ejecución hasta que el canal reciba una señal.
-		s.GracefulShutdown()
+	case <-runFinished:
+	default:
+		server.GracefulShutdown()
+	}
+	<-runFinished
+	for _, httpServer := range []*http.Server{admin, metricsServer} {
+		if httpServer != nil {
+			httpServer.Close()
+		}
+	}
+	log.Info("finish server", "success")
+	time.Sleep(1000 * time.Millisecond)
+}
+
+// startHTTPServer serves the handler on the given address in the background,
+// logging under the given action. Returns nil if the address is empty,
+// which disables it.
+func startHTTPServer(action string, addr string, handler http.Handler) *http.Server {
+	if addr == "" {
+		return nil
+	}
+	httpServer := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		log.Info(action, "in_progress", logger.F("address", addr))
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error(action, "fail", logger.F("error", err))
+		}
+	}()
+	return httpServer
+}
+
+// reloadConfig reads the configuration again and applies to the server the
+// settings that can change at runtime, logging which ones changed.
+func reloadConfig(server *common.Server) {
+	config, err := common.LoadConfig(configPath)
+	if err != nil {
+		log.Error("reload_config", "fail", logger.F("error", err))
+		return
+	}
+	changes, err := server.Reload(config)
+	if err != nil {
+		log.Error("reload_config", "fail", logger.F("error", err))
+		return
+	}
+	if err := logger.Init(config.LogLevel, config.LogFormat); err != nil {
+		log.Error("reload_config", "fail", logger.F("error", err))
+		return
 	}
+	log.Info("reload_config", "success", logger.F("applied", changes.Applied), logger.F("restart_required", changes.RestartRequired))
 }
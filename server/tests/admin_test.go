@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// startAdminAPI serves the admin API of the server for the duration of the test.
+func startAdminAPI(t *testing.T, server *common.Server) string {
+	t.Helper()
+	admin := httptest.NewServer(server.AdminHandler())
+	t.Cleanup(admin.Close)
+	return admin.URL
+}
+
+// adminRequest sends a request to the admin API, checks its status and
+// decodes the JSON answer into value, if given.
+func adminRequest(t *testing.T, method string, url string, status int, value interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("Error building request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Fatalf("Expected status %d for %s %s, got %d", status, method, url, resp.StatusCode)
+	}
+	if value != nil {
+		if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+			t.Fatalf("Error decoding answer: %v", err)
+		}
+	}
+}
+
+// TestAdminReportsContestState tests that the admin API reports the state
+// of each agency and of the draw, and the winners once it was performed.
+func TestAdminReportsContestState(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1, 2}})
+	admin := startAdminAPI(t, server)
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\n1,first,last,10000001,2000-12-20,1234", 2)
+	storeBets(t, addr, "2,first,last,10000002,2000-12-20,1234\n2,first,last,1000000x,2000-12-20,1234", 1)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+
+	var agencies []common.AgencyStatus
+	adminRequest(t, http.MethodGet, admin+"/agencies", http.StatusOK, &agencies)
+	expected := []common.AgencyStatus{
+		{Agency: 1, Finished: true, Bets: 2},
+		{Agency: 2, Finished: false, Bets: 1, Rejected: 1},
+	}
+	if len(agencies) != len(expected) {
+		t.Fatalf("Expected agencies %v, got %v", expected, agencies)
+	}
+	for i := range expected {
+		if agencies[i] != expected[i] {
+			t.Errorf("Expected agency %v, got %v", expected[i], agencies[i])
+		}
+	}
+
+	var draw common.DrawStatus
+	adminRequest(t, http.MethodGet, admin+"/draw", http.StatusOK, &draw)
+	if draw.Performed {
+		t.Errorf("Expected the draw not to be performed yet")
+	}
+	adminRequest(t, http.MethodGet, admin+"/winners?agency=1", http.StatusConflict, nil)
+
+	adminRequest(t, http.MethodPost, admin+"/draw", http.StatusOK, &draw)
+	if !draw.Performed || len(draw.AbsentAgencies) != 1 || draw.AbsentAgencies[0] != 2 {
+		t.Errorf("Expected the draw to be performed with agency 2 absent, got %+v", draw)
+	}
+	adminRequest(t, http.MethodPost, admin+"/draw", http.StatusConflict, nil)
+
+	var winners []common.WinnerStatus
+	adminRequest(t, http.MethodGet, admin+"/winners?agency=1", http.StatusOK, &winners)
+	if len(winners) != 1 || winners[0] != (common.WinnerStatus{Document: "10000000", Payout: "0.00"}) {
+		t.Errorf("Expected agency 1 winners [10000000 0.00], got %v", winners)
+	}
+	adminRequest(t, http.MethodGet, admin+"/winners?agency=2", http.StatusNotFound, nil)
+
+	adminRequest(t, http.MethodPost, admin+"/round/close", http.StatusOK, &draw)
+	if !draw.Archived {
+		t.Errorf("Expected the round to be archived")
+	}
+	adminRequest(t, http.MethodGet, admin+"/winners?agency=1", http.StatusGone, nil)
+}
+
+// TestAdminRegistersAgencies tests that agencies can be registered through
+// the admin API before the draw.
+func TestAdminRegistersAgencies(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}})
+	admin := startAdminAPI(t, server)
+
+	adminRequest(t, http.MethodPost, admin+"/agencies?agency=3", http.StatusCreated, nil)
+	adminRequest(t, http.MethodPost, admin+"/agencies?agency=3", http.StatusConflict, nil)
+	adminRequest(t, http.MethodPost, admin+"/agencies?agency=x", http.StatusBadRequest, nil)
+	storeBets(t, addr, "3,first,last,10000000,2000-12-20,7574", 1)
+}
+
+// TestAdminDrainStopsAcceptingConnections tests that draining the server
+// through the admin API stops it from accepting new connections.
+func TestAdminDrainStopsAcceptingConnections(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}})
+	admin := startAdminAPI(t, server)
+
+	adminRequest(t, http.MethodPost, admin+"/drain", http.StatusAccepted, nil)
+	if server.IsRunning() {
+		t.Errorf("Expected the server to stop running after draining")
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		conn.Close()
+		t.Errorf("Expected new connections to be refused after draining")
+	}
+	adminRequest(t, http.MethodPut, admin+"/drain", http.StatusMethodNotAllowed, nil)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestBatchCarriesDelimitersInNames tests that names with commas, quotes,
+// semicolons and line breaks are stored exactly as the agency sent them.
+func TestBatchCarriesDelimitersInNames(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	batch := protocol.EncodeBet([]string{"1", "Ana, María", `O"Neil`, "10000000", "2000-12-20", "7574"}) +
+		protocol.EncodeBet([]string{"1", "Juan;Pablo", "Pérez\nGómez", "10000001", "2000-12-20", "7575"})
+	storeBets(t, addr, batch, 2)
+
+	answer := request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	summary, err := protocol.ParseReconciliation(answer)
+	if err != nil {
+		t.Fatalf("Error parsing answer %q: %v", answer, err)
+	}
+	digest := protocol.NewBetDigest()
+	digest.Add("Ana, María", `O"Neil`, "10000000", "2000-12-20", 7574, 0)
+	digest.Add("Juan;Pablo", "Pérez\nGómez", "10000001", "2000-12-20", 7575, 0)
+	if summary.Digest != digest.Sum() {
+		t.Errorf("Expected the names to be stored as sent, got reconciliation %v", summary)
+	}
+}
+
+// TestMalformedRecordIsRejected tests that a record that is not valid CSV is
+// rejected without affecting the rest of the batch.
+func TestMalformedRecordIsRejected(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	ack := storeBets(t, addr, "1,fi\"rst,last,10000000,2000-12-20,7574\n1,first,last,10000001,2000-12-20,7575\n", 1)
+	expected := []protocol.BetRejection{{Index: 0, Reason: common.ReasonInvalidFormat}}
+	if len(ack.Rejections) != 1 || ack.Rejections[0] != expected[0] {
+		t.Errorf("Expected rejections %v, got %v", expected, ack.Rejections)
+	}
+	if len(ack.Receipts) != 1 || ack.Receipts[0].Index != 1 {
+		t.Errorf("Expected the second bet to be stored, got receipts %v", ack.Receipts)
+	}
+}
+
+// TestBettorNamedAsARequestIsStored tests that a batch whose first bettor is
+// named like a request is stored as bets instead of being answered as that
+// request.
+func TestBettorNamedAsARequestIsStored(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	for i, name := range []string{protocol.PingRequest, protocol.FinishedRequest} {
+		bet := protocol.EncodeBet([]string{"1", name, "last", strconv.Itoa(10000000 + i), "2000-12-20", "7574"})
+		ack := storeBets(t, addr, bet, 1)
+		if len(ack.Receipts) != 1 {
+			t.Errorf("Expected bettor %q to be stored, got %v", name, ack)
+		}
+	}
+}
+
+// TestUnknownMessageTypeIsRejected tests that a frame whose type is not a
+// known message gets an error instead of being stored as bets.
+func TestUnknownMessageTypeIsRejected(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	answer := request(t, addr, "1,first,last,10000000,2000-12-20,7574")
+	if _, isError := protocol.ParseErrorMessage(answer); !isError {
+		t.Errorf("Expected a frame without a type to be rejected, got %q", answer)
+	}
+}
+
+// TestRequestArgumentsCarryCommas tests that an amendment whose names
+// contain commas reaches the server with the names unchanged.
+func TestRequestArgumentsCarryCommas(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	ack := storeBets(t, addr, protocol.EncodeBet([]string{"1", "first", "last", "10000000", "2000-12-20", "7574"}), 1)
+	answer := request(t, addr, protocol.Request("1", protocol.AmendBetRequest, ack.Receipts[0].BetID, "Ana, María", "Pérez, Gómez", "10000000", "2000-12-20", "7574"))
+	if answer != protocol.BetAmended {
+		t.Fatalf("Expected bet to be amended, got %q", answer)
+	}
+
+	answer = request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	summary, err := protocol.ParseReconciliation(answer)
+	if err != nil {
+		t.Fatalf("Error parsing answer %q: %v", answer, err)
+	}
+	digest := protocol.NewBetDigest()
+	digest.Add("Ana, María", "Pérez, Gómez", "10000000", "2000-12-20", 7574, 0)
+	if summary.Digest != digest.Sum() {
+		t.Errorf("Expected the amended names to be stored as sent, got reconciliation %v", summary)
+	}
+}
+
+// TestBatchAckCarriesCommasInReasons tests that a rejection reason with
+// commas survives encoding and parsing the ack.
+func TestBatchAckCarriesCommasInReasons(t *testing.T) {
+	ack := protocol.BatchAck{
+		Stored:     1,
+		Receipts:   []protocol.BetReceipt{{Index: 0, BetID: "bet0", Signature: "abc"}},
+		Rejections: []protocol.BetRejection{{Index: 1, Reason: "invalid, \"number\""}},
+	}
+	parsed, err := protocol.ParseBatchAck(ack.Encode())
+	if err != nil {
+		t.Fatalf("Error parsing ack: %v", err)
+	}
+	if !reflect.DeepEqual(ack, parsed) {
+		t.Errorf("Expected ack %v, got %v", ack, parsed)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestLoadBetsAppliesAmendmentsAndCancellations tests that only the latest
+// version of each bet is loaded, in the order bets were first stored.
+func TestLoadBetsAppliesAmendmentsAndCancellations(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(storageFilePath)
+	})
+
+	bet0, _ := common.NewBet("1", "first_0", "last_0", "10000000", "2000-12-20", "7500")
+	bet0.ID = "bet0"
+	bet1, _ := common.NewBet("1", "first_1", "last_1", "10000001", "2000-12-21", "7501")
+	bet1.ID = "bet1"
+	bet2, _ := common.NewBet("1", "first_2", "last_2", "10000002", "2000-12-22", "7502")
+	bet2.ID = "bet2"
+	if err := common.StoreBets([]common.Bet{bet0, bet1, bet2}); err != nil {
+		t.Fatalf("Error storing bets: %v", err)
+	}
+
+	amended := bet0
+	amended.Number = 7574
+	amended.Amount = 15050
+	if err := common.StoreBetAmendment(amended); err != nil {
+		t.Fatalf("Error storing amendment: %v", err)
+	}
+	if err := common.StoreBetCancellation(bet1); err != nil {
+		t.Fatalf("Error storing cancellation: %v", err)
+	}
+
+	loadedBets, err := common.LoadBets()
+	if err != nil {
+		t.Fatalf("Error loading bets: %v", err)
+	}
+	if len(loadedBets) != 2 {
+		t.Fatalf("Expected 2 bets, got %d", len(loadedBets))
+	}
+	assertEqualBet(t, amended, loadedBets[0])
+	assertEqualBet(t, bet2, loadedBets[1])
+}
+
+// TestAgencyCanChangeBetsUntilItFinishes tests amending and cancelling bets
+// through the server, which is only allowed before the agency finishes.
+func TestAgencyCanChangeBetsUntilItFinishes(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1, 2}})
+
+	ack := storeBets(t, addr, "1,first,last,10000000,2000-12-20,7500\n1,first,last,10000001,2000-12-20,7501", 2)
+	if len(ack.Receipts) != 2 {
+		t.Fatalf("Expected 2 receipts, got %v", ack.Receipts)
+	}
+	amendedID, cancelledID := ack.Receipts[0].BetID, ack.Receipts[1].BetID
+
+	answer := request(t, addr, protocol.Request("2", protocol.CancelBetRequest, cancelledID))
+	if _, isError := protocol.ParseErrorMessage(answer); !isError {
+		t.Errorf("Expected agency 2 not to be able to cancel a bet of agency 1, got %q", answer)
+	}
+	answer = request(t, addr, protocol.Request("1", protocol.AmendBetRequest, amendedID, "first", "last", "10000000", "2000-12-20", "7574"))
+	if answer != protocol.BetAmended {
+		t.Errorf("Expected bet to be amended, got %q", answer)
+	}
+	answer = request(t, addr, protocol.Request("1", protocol.CancelBetRequest, cancelledID))
+	if answer != protocol.BetCancelled {
+		t.Errorf("Expected bet to be cancelled, got %q", answer)
+	}
+
+	request(t, addr, protocol.Request("1", protocol.WinnersRequest))
+	answer = request(t, addr, protocol.Request("1", protocol.AmendBetRequest, amendedID, "first", "last", "10000000", "2000-12-20", "1"))
+	if _, isError := protocol.ParseErrorMessage(answer); !isError {
+		t.Errorf("Expected amendments to be rejected once the agency finished, got %q", answer)
+	}
+
+	bets, err := common.LoadBets()
+	if err != nil {
+		t.Fatalf("Error loading bets: %v", err)
+	}
+	if len(bets) != 1 || bets[0].ID != amendedID || bets[0].Number != 7574 {
+		t.Errorf("Expected only the amended bet to be stored, got %v", bets)
+	}
+}
+
+// TestStoredBetsReceiveSignedReceipts tests that every stored bet gets a
+// unique ticket ID signed with the receipt key.
+func TestStoredBetsReceiveSignedReceipts(t *testing.T) {
+	key := "secret"
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}, ReceiptKey: key})
+
+	ack := storeBets(t, addr, "1,first,last,10000000,2000-12-20,7500\n1,first,last,10000001,2000-12-20,7501", 2)
+	if len(ack.Receipts) != 2 || ack.Receipts[0].BetID == ack.Receipts[1].BetID {
+		t.Fatalf("Expected 2 receipts with different ticket IDs, got %v", ack.Receipts)
+	}
+	expected := protocol.ReceiptSignature([]byte(key), ack.Receipts[1].BetID, "1", "10000001", "7501", 0)
+	if ack.Receipts[1].Signature != expected {
+		t.Errorf("Expected signature %s, got %s", expected, ack.Receipts[1].Signature)
+	}
+}
+
+// TestReceiptSignatureCoversStake tests that the receipt of a bet with a
+// stake is signed for that stake.
+func TestReceiptSignatureCoversStake(t *testing.T) {
+	key := "secret"
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}, ReceiptKey: key})
+
+	ack := storeBets(t, addr, "1,first,last,10000000,2000-12-20,7500,150.50", 1)
+	if len(ack.Receipts) != 1 {
+		t.Fatalf("Expected 1 receipt, got %v", ack.Receipts)
+	}
+	signature := ack.Receipts[0].Signature
+	if signature != protocol.ReceiptSignature([]byte(key), ack.Receipts[0].BetID, "1", "10000000", "7500", 15050) {
+		t.Errorf("Expected the receipt to be signed for a stake of 150.50")
+	}
+	if signature == protocol.ReceiptSignature([]byte(key), ack.Receipts[0].BetID, "1", "10000000", "7500", 150050) {
+		t.Errorf("Expected the receipt not to verify for another stake")
+	}
+}
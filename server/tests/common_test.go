@@ -10,6 +10,8 @@ import (
 )
 
 const storageFilePath = "./bets.csv"
+const resultsFilePath = "./results.csv"
+const rejectionsFilePath = "./rejections.csv"
 const lotteryWinnerNumber = 7574
 
 // TestBetInitMustKeepFields tests that a Bet is initialized correctly.
@@ -138,4 +140,7 @@ func assertEqualBet(t *testing.T, b1, b2 common.Bet) {
 	if b1.Number != b2.Number {
 		t.Errorf("Number mismatch: expected %d, got %d", b1.Number, b2.Number)
 	}
+	if b1.Amount != b2.Amount {
+		t.Errorf("Amount mismatch: expected %d, got %d", b1.Amount, b2.Amount)
+	}
 }
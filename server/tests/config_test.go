@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// writeConfigFile writes a config.ini with the given contents to a temporary
+// directory and returns its path.
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.ini")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+const testConfigFile = `[DEFAULT]
+SERVER_PORT = 12345
+SERVER_IP = 127.0.0.1
+SERVER_LISTEN_BACKLOG = 7
+LOGGING_LEVEL = DEBUG
+`
+
+// TestLoadConfigReadsFile tests that every value of config.ini ends up in
+// the configuration.
+func TestLoadConfigReadsFile(t *testing.T) {
+	config, err := common.LoadConfig(writeConfigFile(t, testConfigFile))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Port != 12345 || config.IP != "127.0.0.1" || config.ListenBacklog != 7 || config.LogLevel != "DEBUG" {
+		t.Errorf("Expected the values of the file, got %+v", config)
+	}
+}
+
+// TestLoadConfigEnvOverridesFile tests that env vars take precedence over
+// config.ini, and that the values not overridden are kept from the file.
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	t.Setenv("SERVER_PORT", "23456")
+	t.Setenv("LOGGING_LEVEL", "WARNING")
+	t.Setenv("SERVER_MIN_AGE", "21")
+
+	config, err := common.LoadConfig(writeConfigFile(t, testConfigFile))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Port != 23456 || config.LogLevel != "WARNING" || config.MinAge != 21 {
+		t.Errorf("Expected the values of the env vars, got %+v", config)
+	}
+	if config.ListenBacklog != 7 || config.IP != "127.0.0.1" {
+		t.Errorf("Expected the values of the file not overridden, got %+v", config)
+	}
+}
+
+// TestLoadConfigDefaults tests the values used when neither the file nor
+// the environment set them.
+func TestLoadConfigDefaults(t *testing.T) {
+	config, err := common.LoadConfig(filepath.Join(t.TempDir(), "missing.ini"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Port != common.DefaultPort || config.ListenBacklog != common.DefaultListenBacklog || config.LogLevel != common.DefaultLogLevel {
+		t.Errorf("Expected the default values, got %+v", config)
+	}
+}
+
+// TestLoadConfigRejectsInvalidValues tests that invalid values are reported
+// at startup with an error naming the offending setting.
+func TestLoadConfigRejectsInvalidValues(t *testing.T) {
+	cases := []struct {
+		env      string
+		value    string
+		expected string
+	}{
+		{"SERVER_LISTEN_BACKLOG", "many", "SERVER_LISTEN_BACKLOG"},
+		{"SERVER_LISTEN_BACKLOG", "-1", "listen backlog"},
+		{"SERVER_PORT", "70000", "port"},
+		{"LOGGING_LEVEL", "LOUD", "log level"},
+		{"SERVER_LOG_FORMAT", "xml", "log format"},
+	}
+	for _, c := range cases {
+		t.Run(c.env+"="+c.value, func(t *testing.T) {
+			t.Setenv(c.env, c.value)
+			_, err := common.LoadConfig(writeConfigFile(t, testConfigFile))
+			if err == nil || !strings.Contains(err.Error(), c.expected) {
+				t.Errorf("Expected an error about %s, got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+// TestNewServerValidatesConfig tests that a Server is not started with an
+// invalid configuration.
+func TestNewServerValidatesConfig(t *testing.T) {
+	if _, err := common.NewServer(common.ServerConfig{Port: 12345, ListenBacklog: -1}); err == nil {
+		t.Errorf("Expected a negative backlog to be rejected")
+	}
+}
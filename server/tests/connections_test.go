@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestConnectionRegistryTracksAgencies tests that the registry reports the
+// agency, operation and bytes of each connection, and closes only the
+// connections of the given agency.
+func TestConnectionRegistryTracksAgencies(t *testing.T) {
+	registry := common.NewConnectionRegistry()
+	first, firstPeer := net.Pipe()
+	second, secondPeer := net.Pipe()
+	defer firstPeer.Close()
+	defer secondPeer.Close()
+
+	tracked := registry.Add(first)
+	other := registry.Add(second)
+	tracked.SetAgency(1)
+	tracked.SetOperation(common.OperationWinners)
+	other.SetAgency(2)
+	go firstPeer.Read(make([]byte, 5))
+	if _, err := tracked.Write([]byte("hello")); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+
+	connections := registry.List()
+	if len(connections) != 2 {
+		t.Fatalf("Expected 2 connections, got %v", connections)
+	}
+	if connections[0].Agency != 1 || connections[0].Operation != common.OperationWinners || connections[0].BytesSent != 5 {
+		t.Errorf("Expected the first connection to be of agency 1, got %+v", connections[0])
+	}
+
+	closed := registry.CloseAgency(1)
+	if len(closed) != 1 || closed[0].Agency != 1 {
+		t.Errorf("Expected only the connection of agency 1 to be closed, got %v", closed)
+	}
+	if _, err := firstPeer.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Expected the connection of agency 1 to be closed")
+	}
+	if registry.Remove(tracked) {
+		t.Errorf("Expected a closed connection not to be removed again")
+	}
+	if !registry.Remove(other) {
+		t.Errorf("Expected the connection of agency 2 to be removed")
+	}
+	if connections := registry.List(); len(connections) != 0 {
+		t.Errorf("Expected no connections left, got %v", connections)
+	}
+}
+
+// TestAdminListsAndClosesConnections tests that the admin API lists the open
+// connections and closes them by agency.
+func TestAdminListsAndClosesConnections(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}})
+	admin := startAdminAPI(t, server)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer conn.Close()
+
+	var connections []common.ConnectionInfo
+	for attempt := 0; len(connections) == 0 && attempt < 50; attempt++ {
+		time.Sleep(10 * time.Millisecond)
+		adminRequest(t, http.MethodGet, admin+"/connections", http.StatusOK, &connections)
+	}
+	if len(connections) != 1 || connections[0].Agency != 0 || connections[0].Operation != common.OperationReading {
+		t.Fatalf("Expected a connection reading its first message, got %+v", connections)
+	}
+	adminRequest(t, http.MethodGet, admin+"/connections?agency=1", http.StatusOK, &connections)
+	if len(connections) != 0 {
+		t.Errorf("Expected no connections of agency 1, got %+v", connections)
+	}
+
+	var closed []common.ConnectionInfo
+	adminRequest(t, http.MethodPost, admin+"/connections/close?agency=0", http.StatusOK, &closed)
+	if len(closed) != 1 {
+		t.Errorf("Expected the connection to be closed, got %+v", closed)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("Expected the server to close the connection, got %v", err)
+	}
+	adminRequest(t, http.MethodPost, admin+"/connections/close?agency=x", http.StatusBadRequest, nil)
+}
+
+// isTimeout tells whether the error is a network timeout.
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
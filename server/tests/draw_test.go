@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestDrawDeadlineMarksMissingAgenciesAbsent tests that once the draw deadline
+// passes the draw is performed and the agencies that never finished are rejected.
+func TestDrawDeadlineMarksMissingAgenciesAbsent(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{
+		Agencies:     []int{1, 2},
+		DrawDeadline: 200 * time.Millisecond,
+	})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	if answer := request(t, addr, protocol.Request("1", protocol.WinnersRequest)); answer != "No winners yet" {
+		t.Fatalf("Expected no winners before the deadline, got %q", answer)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+
+	answer := request(t, addr, protocol.BatchMessage("2,first,last,10000001,2000-12-20,7574"))
+	if reason, isError := protocol.ParseErrorMessage(answer); !isError || !strings.Contains(reason, "absent") {
+		t.Errorf("Expected late bets of agency 2 to be rejected, got %q", answer)
+	}
+	answer = request(t, addr, protocol.Request("2", protocol.WinnersRequest))
+	if _, isError := protocol.ParseErrorMessage(answer); !isError {
+		t.Errorf("Expected absent agency 2 to get an error, got %q", answer)
+	}
+	if answer := request(t, addr, protocol.Request("1", protocol.WinnersRequest)); answer != "ganadores,\n10000000:0.00" {
+		t.Errorf("Expected agency 1 winners page with 10000000:0.00, got %q", answer)
+	}
+}
+
+// TestWinnersArePaginated tests that the winners of an agency are sent in
+// pages linked by continuation tokens that together hold every winner.
+func TestWinnersArePaginated(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}, WinnersPageSize: 2})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\n1,first,last,10000001,2000-12-20,7574\n1,first,last,10000002,2000-12-20,1234\n1,first,last,10000003,2000-12-20,7574\n1,first,last,10000004,2000-12-20,7574\n1,first,last,10000005,2000-12-20,7574", 6)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+
+	answer := waitForDraw(t, addr, protocol.Request("1", protocol.WinnersRequest))
+
+	var documents []string
+	pages := 0
+	for {
+		page, err := protocol.ParseWinnersPage(answer)
+		if err != nil {
+			t.Fatalf("Error parsing answer %q: %v", answer, err)
+		}
+		pages++
+		if len(page.Winners) > 2 {
+			t.Errorf("Expected at most 2 winners per page, got %d", len(page.Winners))
+		}
+		for _, winner := range page.Winners {
+			documents = append(documents, winner.Document)
+		}
+		if page.Next == "" {
+			break
+		}
+		answer = request(t, addr, protocol.Request("1", protocol.WinnersRequest, page.Next))
+	}
+
+	expected := []string{"10000000", "10000001", "10000003", "10000004", "10000005"}
+	if pages != 3 {
+		t.Errorf("Expected 3 pages of winners, got %d", pages)
+	}
+	if strings.Join(documents, ";") != strings.Join(expected, ";") {
+		t.Errorf("Expected winners %v, got %v", expected, documents)
+	}
+}
+
+// TestWinnersPagesFitInAFrame tests that pages are cut before their frame
+// exceeds the protocol limit, even if they hold fewer winners than the page
+// size.
+func TestWinnersPagesFitInAFrame(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}, WinnersPageSize: common.DefaultWinnersPageSize})
+
+	for batch := 0; batch < 10; batch++ {
+		var bets []string
+		for i := 0; i < 100; i++ {
+			bets = append(bets, fmt.Sprintf("1,first,last,%d,2000-12-20,7574", 10000000+batch*100+i))
+		}
+		storeBets(t, addr, strings.Join(bets, "\n"), 100)
+	}
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+
+	answer := waitForDraw(t, addr, protocol.Request("1", protocol.WinnersRequest))
+	winners, pages := 0, 0
+	for {
+		if size := protocol.FrameSize(len(answer)); size > protocol.MaxFrameSize {
+			t.Errorf("Expected every page to fit in a frame, got %d bytes", size)
+		}
+		page, err := protocol.ParseWinnersPage(answer)
+		if err != nil {
+			t.Fatalf("Error parsing answer %q: %v", answer, err)
+		}
+		pages++
+		winners += len(page.Winners)
+		if page.Next == "" {
+			break
+		}
+		answer = request(t, addr, protocol.Request("1", protocol.WinnersRequest, page.Next))
+	}
+
+	if winners != 1000 {
+		t.Errorf("Expected 1000 winners, got %d", winners)
+	}
+	if pages < 2 {
+		t.Errorf("Expected the winners to be split in several pages, got %d", pages)
+	}
+}
+
+// TestWinnersRejectInvalidContinuationToken tests that a continuation token
+// that does not point to a page of the agency winners is answered with an error.
+func TestWinnersRejectInvalidContinuationToken(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}, WinnersPageSize: 2})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	answer := waitForDraw(t, addr, protocol.Request("1", protocol.WinnersRequest, "7"))
+	if _, isError := protocol.ParseErrorMessage(answer); !isError {
+		t.Errorf("Expected an invalid continuation token to get an error, got %q", answer)
+	}
+}
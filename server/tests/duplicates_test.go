@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestDuplicateDetectorFindsBetsAndDocuments tests that repeated bets and
+// documents betting through another agency are detected.
+func TestDuplicateDetectorFindsBetsAndDocuments(t *testing.T) {
+	detector := common.NewDuplicateDetector()
+	bet, _ := common.NewBet("1", "first", "last", "10000000", "2000-12-20", "7500")
+	sameDocument, _ := common.NewBet("2", "first", "last", "10000000", "2000-12-20", "1234")
+	other, _ := common.NewBet("1", "other", "last", "20000000", "2000-12-20", "7500")
+
+	if reason := detector.Find(bet, nil); reason != "" {
+		t.Errorf("Expected first bet not to be a duplicate, got %s", reason)
+	}
+	if reason := detector.Find(bet, []common.Bet{bet}); reason != common.ReasonDuplicatedBet {
+		t.Errorf("Expected bet repeated within a batch to be a duplicate, got %q", reason)
+	}
+	detector.Record([]common.Bet{bet})
+
+	if reason := detector.Find(bet, nil); reason != common.ReasonDuplicatedBet {
+		t.Errorf("Expected %s, got %q", common.ReasonDuplicatedBet, reason)
+	}
+	if reason := detector.Find(sameDocument, nil); reason != common.ReasonDuplicatedDocument {
+		t.Errorf("Expected %s, got %q", common.ReasonDuplicatedDocument, reason)
+	}
+	if reason := detector.Find(other, nil); reason != "" {
+		t.Errorf("Expected bet with another document not to be a duplicate, got %s", reason)
+	}
+
+	detector.Flag(sameDocument, common.ReasonDuplicatedDocument)
+	detector.Record([]common.Bet{sameDocument})
+	report := detector.Report()
+	if len(report) != 1 || report[0].Document != "10000000" {
+		t.Fatalf("Expected document 10000000 to be flagged, got %v", report)
+	}
+	if len(report[0].Agencies) != 2 {
+		t.Errorf("Expected document to be reported in 2 agencies, got %v", report[0].Agencies)
+	}
+}
+
+// TestServerRejectsDuplicatedDocuments tests the reject duplicate policy.
+func TestServerRejectsDuplicatedDocuments(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{
+		Agencies:        []int{1, 2},
+		DuplicatePolicy: common.DuplicatePolicyReject,
+	})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	ack := storeBets(t, addr, "2,first,last,10000001,2000-12-20,1\n2,first,last,10000000,2000-12-20,7574", 1)
+	if len(ack.Rejections) != 1 {
+		t.Fatalf("Expected 1 rejected bet, got %v", ack.Rejections)
+	}
+	if ack.Rejections[0].Index != 1 || ack.Rejections[0].Reason != common.ReasonDuplicatedDocument {
+		t.Errorf("Expected second bet rejected as %s, got %v", common.ReasonDuplicatedDocument, ack.Rejections[0])
+	}
+}
+
+// TestDuplicateDetectorForget tests that forgetting a bet undoes a single
+// Record of it.
+func TestDuplicateDetectorForget(t *testing.T) {
+	detector := common.NewDuplicateDetector()
+	bet, _ := common.NewBet("1", "first", "last", "10000000", "2000-12-20", "7500")
+	sameDocument, _ := common.NewBet("2", "first", "last", "10000000", "2000-12-20", "1234")
+	detector.Record([]common.Bet{bet, bet})
+
+	detector.Forget(bet)
+	if reason := detector.Find(bet, nil); reason != common.ReasonDuplicatedBet {
+		t.Errorf("Expected the bet recorded twice to still be a duplicate, got %q", reason)
+	}
+	detector.Forget(bet)
+	if reason := detector.Find(bet, nil); reason != "" {
+		t.Errorf("Expected the forgotten bet not to be a duplicate, got %s", reason)
+	}
+	if reason := detector.Find(sameDocument, nil); reason != "" {
+		t.Errorf("Expected the document of the forgotten bet to be free, got %s", reason)
+	}
+}
+
+// TestCancelledBetCanBeResubmitted tests that a cancelled bet is not taken
+// for a duplicate when the agency sends it again.
+func TestCancelledBetCanBeResubmitted(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{
+		Agencies:        []int{1},
+		DuplicatePolicy: common.DuplicatePolicyReject,
+	})
+
+	ack := storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	if answer := request(t, addr, protocol.Request("1", protocol.CancelBetRequest, ack.Receipts[0].BetID)); answer != protocol.BetCancelled {
+		t.Fatalf("Expected bet to be cancelled, got %q", answer)
+	}
+	ack = storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	if len(ack.Rejections) != 0 {
+		t.Errorf("Expected the resubmitted bet not to be rejected, got %v", ack.Rejections)
+	}
+}
+
+// TestAmendedBetIsCheckedForDuplicates tests that an amendment that turns a
+// bet into a copy of another one is rejected, while amending a bet without
+// changing its key is not.
+func TestAmendedBetIsCheckedForDuplicates(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{
+		Agencies:        []int{1},
+		DuplicatePolicy: common.DuplicatePolicyReject,
+	})
+
+	ack := storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\n1,other,last,10000001,2000-12-20,1234", 2)
+	firstID, secondID := ack.Receipts[0].BetID, ack.Receipts[1].BetID
+
+	answer := request(t, addr, protocol.Request("1", protocol.AmendBetRequest, secondID, "first", "last", "10000000", "2000-12-20", "7574"))
+	if reason, isError := protocol.ParseErrorMessage(answer); !isError || reason != common.ReasonDuplicatedBet {
+		t.Errorf("Expected the amendment to be rejected as %s, got %q", common.ReasonDuplicatedBet, answer)
+	}
+	answer = request(t, addr, protocol.Request("1", protocol.AmendBetRequest, firstID, "first", "last", "10000000", "2000-12-20", "7574", "10"))
+	if answer != protocol.BetAmended {
+		t.Errorf("Expected the bet to be amended with a new stake, got %q", answer)
+	}
+	answer = request(t, addr, protocol.Request("1", protocol.AmendBetRequest, secondID, "other", "last", "10000001", "2000-12-20", "4321"))
+	if answer != protocol.BetAmended {
+		t.Errorf("Expected the second bet to still be amendable, got %q", answer)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestReadinessFollowsTheContest tests that the server reports itself ready,
+// both through Ping and the readiness probe, only while accepting bets.
+func TestReadinessFollowsTheContest(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}})
+	admin := startAdminAPI(t, server)
+
+	adminRequest(t, http.MethodGet, admin+"/healthz", http.StatusOK, nil)
+	adminRequest(t, http.MethodGet, admin+"/readyz", http.StatusOK, nil)
+	if answer := request(t, addr, protocol.Request("1", protocol.PingRequest)); answer != protocol.Pong {
+		t.Errorf("Expected %q before the draw, got %q", protocol.Pong, answer)
+	}
+
+	if err := server.PerformDraw(); err != nil {
+		t.Fatalf("Error performing the draw: %v", err)
+	}
+	adminRequest(t, http.MethodGet, admin+"/healthz", http.StatusOK, nil)
+	adminRequest(t, http.MethodGet, admin+"/readyz", http.StatusServiceUnavailable, nil)
+	answer := request(t, addr, protocol.Request("1", protocol.PingRequest))
+	if _, isError := protocol.ParseErrorMessage(answer); !isError {
+		t.Errorf("Expected an error after the draw, got %q", answer)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// startServer starts a server listening on a random port and returns its
+// address. The server is shut down when the test finishes.
+func startServer(t *testing.T, config common.ServerConfig) string {
+	t.Helper()
+	_, addr := startServerInstance(t, config)
+	return addr
+}
+
+// startServerInstance is like startServer but also returns the server, for
+// the tests that need to act on it directly.
+func startServerInstance(t *testing.T, config common.ServerConfig) (*common.Server, string) {
+	t.Helper()
+	t.Cleanup(func() {
+		os.Remove(storageFilePath)
+		os.Remove(rejectionsFilePath)
+		removeResults()
+	})
+
+	server, err := common.NewServer(config)
+	if err != nil {
+		t.Fatalf("Error starting server: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		server.Run()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		if server.IsRunning() {
+			server.GracefulShutdown()
+		}
+		<-done
+	})
+	return server, server.Addr().String()
+}
+
+// removeResults removes the results table and every archived copy of it.
+func removeResults() {
+	archived, _ := filepath.Glob(resultsFilePath + ".*")
+	for _, path := range append(archived, resultsFilePath) {
+		os.Remove(path)
+	}
+}
+
+// waitForDraw sends the request until the server answers something other
+// than NoWinnersYet, and returns that answer.
+func waitForDraw(t *testing.T, addr string, msg string) string {
+	t.Helper()
+	answer := request(t, addr, msg)
+	for attempt := 0; answer == protocol.NoWinnersYet && attempt < 50; attempt++ {
+		time.Sleep(10 * time.Millisecond)
+		answer = request(t, addr, msg)
+	}
+	return answer
+}
+
+// request sends a single message to the server and returns its answer.
+func request(t *testing.T, addr string, msg string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer conn.Close()
+
+	if err := protocol.SendMessage(conn, msg); err != nil {
+		t.Fatalf("Error sending message: %v", err)
+	}
+	answer, err := protocol.ReadReply(conn)
+	if err != nil {
+		t.Fatalf("Error reading answer: %v", err)
+	}
+	return answer
+}
+
+// storeBets sends a batch with the given bets, one CSV record per line, and
+// checks that the expected amount of bets was stored.
+func storeBets(t *testing.T, addr string, bets string, expected int) protocol.BatchAck {
+	t.Helper()
+	answer := request(t, addr, protocol.BatchMessage(bets))
+	ack, err := protocol.ParseBatchAck(answer)
+	if err != nil {
+		t.Fatalf("Error parsing answer %q: %v", answer, err)
+	}
+	if ack.Stored != expected {
+		t.Fatalf("Expected %d bets to be stored, got %q", expected, answer)
+	}
+	return ack
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// deliverResults runs a contest with a single agency and asks for its
+// winners, so that every result is delivered.
+func deliverResults(t *testing.T, addr string) {
+	t.Helper()
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	waitForDraw(t, addr, protocol.Request("1", protocol.WinnersRequest))
+}
+
+// TestServerKeepsRunningAfterResultsDelivered tests that the server does not
+// shut itself down once every agency got its winners, and keeps answering.
+func TestServerKeepsRunningAfterResultsDelivered(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}})
+	deliverResults(t, addr)
+
+	select {
+	case <-server.ResultsDelivered():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected results to be reported as delivered")
+	}
+	select {
+	case <-server.ShutdownDue():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the exit policy to ask for a shutdown")
+	}
+	if !server.IsRunning() {
+		t.Fatalf("Expected the server to leave the shutdown to its owner")
+	}
+	if answer := request(t, addr, protocol.Request("1", protocol.WinnersRequest)); answer != "ganadores,\n10000000:0.00" {
+		t.Errorf("Expected late winners request to be answered, got %q", answer)
+	}
+}
+
+// TestGracePeriodPolicyDelaysShutdown tests that the grace period policy asks
+// for a shutdown only once the grace period passes.
+func TestGracePeriodPolicyDelaysShutdown(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{
+		Agencies:           []int{1},
+		LifecyclePolicy:    common.LifecyclePolicyGracePeriod,
+		ResultsGracePeriod: 300 * time.Millisecond,
+	})
+	due := server.ShutdownDue()
+	deliverResults(t, addr)
+	<-server.ResultsDelivered()
+	delivered := time.Now()
+
+	select {
+	case <-due:
+		if elapsed := time.Since(delivered); elapsed < 200*time.Millisecond {
+			t.Errorf("Expected shutdown to wait for the grace period, waited %v", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected a shutdown once the grace period passed")
+	}
+}
+
+// TestStayUpPolicyNeverAsksForShutdown tests that the stay up policy keeps
+// the server running after the results are delivered.
+func TestStayUpPolicyNeverAsksForShutdown(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{
+		Agencies:        []int{1},
+		LifecyclePolicy: common.LifecyclePolicyStayUp,
+	})
+	deliverResults(t, addr)
+	<-server.ResultsDelivered()
+
+	select {
+	case <-server.ShutdownDue():
+		t.Errorf("Expected the stay up policy to never ask for a shutdown")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestRateLimiterRefillsTokens tests that each agency can send a burst of
+// messages and then one more for every token refilled.
+func TestRateLimiterRefillsTokens(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := common.NewRateLimiter(2, 3)
+	limiter.Now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(1) {
+			t.Fatalf("Expected message %d of the burst to be allowed", i)
+		}
+	}
+	if limiter.Allow(1) {
+		t.Errorf("Expected a message over the burst to be limited")
+	}
+	if !limiter.Allow(2) {
+		t.Errorf("Expected another agency to have its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !limiter.Allow(1) {
+		t.Errorf("Expected a refilled token to allow a message")
+	}
+	if limiter.Allow(1) {
+		t.Errorf("Expected a single token to be refilled")
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(1) {
+			t.Fatalf("Expected the bucket to refill up to the burst")
+		}
+	}
+	if limiter.Allow(1) {
+		t.Errorf("Expected the bucket to hold no more than the burst")
+	}
+}
+
+// TestServerRateLimitsAgency tests that the messages of an agency over its
+// rate limit are answered with a retryable error.
+func TestServerRateLimitsAgency(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1, 2}, RateLimit: 0.001, RateBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		if answer := request(t, addr, protocol.Request("1", protocol.PingRequest)); answer != protocol.Pong {
+			t.Fatalf("Expected ping %d to be answered, got %q", i, answer)
+		}
+	}
+	answer := request(t, addr, protocol.Request("1", protocol.PingRequest))
+	reason, isError := protocol.ParseErrorMessage(answer)
+	if !isError || !protocol.IsRetryableError(reason) {
+		t.Errorf("Expected a retryable error, got %q", answer)
+	}
+	if answer := request(t, addr, protocol.Request("2", protocol.PingRequest)); answer != protocol.Pong {
+		t.Errorf("Expected another agency not to be limited, got %q", answer)
+	}
+}
+
+// TestServerDoesNotRateLimitUnknownAgencies tests that the messages of an
+// agency that is not registered are rejected as such rather than counted
+// against a rate limit.
+func TestServerDoesNotRateLimitUnknownAgencies(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}, RateLimit: 0.001, RateBurst: 1})
+
+	for i := 0; i < 3; i++ {
+		answer := request(t, addr, protocol.Request("9", protocol.FinishedRequest))
+		reason, isError := protocol.ParseErrorMessage(answer)
+		if !isError || protocol.IsRetryableError(reason) {
+			t.Fatalf("Expected message %d of an unknown agency to be rejected, got %q", i, answer)
+		}
+	}
+}
+
+// TestServerBoundsConcurrentHandlers tests that a connection is not handled
+// while the maximum amount of handlers is running, and is handled once one
+// of them finishes.
+func TestServerBoundsConcurrentHandlers(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}, MaxConnections: 1})
+
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer idle.Close()
+
+	waiting, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer waiting.Close()
+	if err := protocol.SendMessage(waiting, protocol.Request("1", protocol.PingRequest)); err != nil {
+		t.Fatalf("Error sending message: %v", err)
+	}
+	waiting.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if answer, err := protocol.ReadReply(waiting); err == nil {
+		t.Fatalf("Expected the second connection to wait, got %q", answer)
+	}
+
+	idle.Close()
+	waiting.SetReadDeadline(time.Now().Add(2 * time.Second))
+	answer, err := protocol.ReadReply(waiting)
+	if err != nil || answer != protocol.Pong {
+		t.Errorf("Expected the second connection to be handled, got %q (%v)", answer, err)
+	}
+}
+
+// TestServerRejectsOversizedFrames tests that the connection is closed
+// without waiting for the body when a frame declares a length over the
+// maximum frame size.
+func TestServerRejectsOversizedFrames(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	for _, header := range []string{"999999999:", "-1:"} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Error connecting to server: %v", err)
+		}
+		if _, err := conn.Write([]byte(header)); err != nil {
+			t.Fatalf("Error sending header: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if answer, err := protocol.ReadReply(conn); err == nil || os.IsTimeout(err) {
+			t.Errorf("Expected the connection to be closed after header %q, got %q (%v)", header, answer, err)
+		}
+		conn.Close()
+	}
+}
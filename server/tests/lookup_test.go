@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestLookupReturnsOnlyTheAgencyBetsOfTheBettor tests that, after the draw,
+// an agency can look up the results of a bettor among its own bets.
+func TestLookupReturnsOnlyTheAgencyBetsOfTheBettor(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1, 2}})
+	lookup := protocol.Request("1", protocol.LookupRequest, "10000000")
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\n1,first,last,10000000,2000-12-20,1234\n1,first,last,10000001,2000-12-20,7574", 3)
+	storeBets(t, addr, "2,first,last,10000000,2000-12-20,7575", 1)
+	if answer := request(t, addr, lookup); answer != protocol.NoWinnersYet {
+		t.Errorf("Expected lookup before the draw to answer %q, got %q", protocol.NoWinnersYet, answer)
+	}
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	request(t, addr, protocol.Request("2", protocol.FinishedRequest))
+
+	answer := waitForDraw(t, addr, lookup)
+	results, err := protocol.ParseBetResults(answer)
+	if err != nil {
+		t.Fatalf("Error parsing answer %q: %v", answer, err)
+	}
+	expected := []protocol.BetResult{
+		{Number: 7574, Won: true},
+		{Number: 1234, Won: false},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected results %v, got %v", expected, results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("Expected result %v, got %v", expected[i], results[i])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestServerExposesMetrics tests that the server counts connections, frames,
+// stored and rejected bets and winners queries.
+func TestServerExposesMetrics(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1, 2}})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\n1,first,last,1000000x,2000-12-20,7574", 1)
+	request(t, addr, protocol.Request("1", protocol.WinnersRequest))
+
+	expected := []string{
+		"lottery_connections_accepted_total 2\n",
+		"lottery_frames_read_total 2\n",
+		"lottery_frames_written_total 2\n",
+		"lottery_bets_stored_total{agency=\"1\"} 1\n",
+		"lottery_bets_rejected_total{agency=\"1\",reason=\"documento_invalido\"} 1\n",
+		"lottery_batch_size_bets_count 1\n",
+		"lottery_store_latency_seconds_count 1\n",
+		"lottery_winners_queries_total{agency=\"1\"} 1\n",
+		"lottery_no_winners_yet_total 1\n",
+	}
+	// The frames are counted once they are sent, which may be right after
+	// the client got them.
+	body := scrapeMetrics(server)
+	for attempt := 0; !containsAll(body, expected) && attempt < 50; attempt++ {
+		time.Sleep(10 * time.Millisecond)
+		body = scrapeMetrics(server)
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "lottery_bytes_received_total 0\n") {
+		t.Errorf("Expected received bytes to be counted, got:\n%s", body)
+	}
+}
+
+// scrapeMetrics returns the metrics the server currently exposes.
+func scrapeMetrics(server *common.Server) string {
+	recorder := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	return recorder.Body.String()
+}
+
+func containsAll(body string, lines []string) bool {
+	for _, line := range lines {
+		if !strings.Contains(body, line) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestRejectionsOfUnknownAgenciesShareALabel tests that batches sent by
+// agencies that are not registered, or whose agency can not be read, are
+// counted under a single label instead of one per agency id.
+func TestRejectionsOfUnknownAgenciesShareALabel(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}})
+
+	request(t, addr, protocol.BatchMessage("1234,first,last,10000001,2000-12-20,7574\n"))
+	request(t, addr, protocol.BatchMessage("x,first,last\n"))
+
+	body := scrapeMetrics(server)
+	expected := []string{
+		"lottery_bets_rejected_total{agency=\"unknown\",reason=\"agencia_desconocida\"} 1\n",
+		"lottery_bets_rejected_total{agency=\"unknown\",reason=\"formato_invalido\"} 1\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "agency=\"1234\"") {
+		t.Errorf("Expected no label for the unregistered agency, got:\n%s", body)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// newStakedBet creates a bet with the given number and stake in cents.
+func newStakedBet(t *testing.T, document string, number string, amount int64) common.Bet {
+	t.Helper()
+	bet, err := common.NewBet("1", "first", "last", document, "2000-12-20", number)
+	if err != nil {
+		t.Fatalf("Error creating Bet: %v", err)
+	}
+	bet.Amount = amount
+	return bet
+}
+
+// TestComputePrizesSplitsPoolByTierAndStake tests that, after the house keeps
+// its share, each tier splits its part of the pool proportionally to the stakes.
+func TestComputePrizesSplitsPoolByTierAndStake(t *testing.T) {
+	bets := []common.Bet{
+		newStakedBet(t, "10000000", "7574", 10000),
+		newStakedBet(t, "10000001", "7574", 30000),
+		newStakedBet(t, "10000002", "1574", 20000),
+		newStakedBet(t, "10000003", "1234", 40000),
+	}
+	rules := common.PrizeRules{HousePercentage: 10, TierSplits: []int{80, 20}}
+
+	pool, prizes := common.ComputePrizes(bets, rules)
+	if pool != 100000 {
+		t.Errorf("Expected pool of 100000 cents, got %d", pool)
+	}
+	expected := map[string]int64{
+		"10000000": 18000,
+		"10000001": 54000,
+		"10000002": 18000,
+	}
+	if len(prizes) != len(expected) {
+		t.Fatalf("Expected %d prizes, got %v", len(expected), prizes)
+	}
+	for _, prize := range prizes {
+		if prize.Payout != expected[prize.Bet.Document] {
+			t.Errorf("Expected payout %d for %s, got %d", expected[prize.Bet.Document], prize.Bet.Document, prize.Payout)
+		}
+	}
+}
+
+// TestComputePrizesWithLargeStakes tests that payouts are exact when the
+// pool times a stake does not fit in an int64.
+func TestComputePrizesWithLargeStakes(t *testing.T) {
+	var bets []common.Bet
+	for i := 0; i < 1000; i++ {
+		bets = append(bets, newStakedBet(t, strconv.Itoa(10000000+i), "7574", 100000000))
+	}
+
+	pool, prizes := common.ComputePrizes(bets, common.DefaultPrizeRules)
+	if pool != 100000000000 {
+		t.Errorf("Expected pool of 100000000000 cents, got %d", pool)
+	}
+	for _, prize := range prizes {
+		if prize.Payout != 100000000 {
+			t.Fatalf("Expected payout of 100000000 cents, got %d", prize.Payout)
+		}
+	}
+}
+
+// TestValidateBetBoundsStake tests that stakes over the maximum are rejected.
+func TestValidateBetBoundsStake(t *testing.T) {
+	rules := common.ValidationRules{MinAge: 18}
+	if err := common.ValidateBet(newStakedBet(t, "10000000", "7574", 100000000), rules); err != nil {
+		t.Errorf("Expected the maximum stake to be valid, got %v", err)
+	}
+	err := common.ValidateBet(newStakedBet(t, "10000000", "7574", 100000001), rules)
+	if validationErr, ok := err.(*common.BetValidationError); !ok || validationErr.Reason != common.ReasonInvalidAmount {
+		t.Errorf("Expected a stake over the maximum to be rejected, got %v", err)
+	}
+}
+
+// TestPrizeRulesValidate tests that inconsistent percentages are rejected.
+func TestPrizeRulesValidate(t *testing.T) {
+	if err := (common.PrizeRules{HousePercentage: 10, TierSplits: []int{70, 30}}).Validate(); err != nil {
+		t.Errorf("Expected rules to be valid, got %v", err)
+	}
+	if err := (common.PrizeRules{HousePercentage: 110, TierSplits: []int{100}}).Validate(); err == nil {
+		t.Errorf("Expected house percentage above 100 to be invalid")
+	}
+	if err := (common.PrizeRules{TierSplits: []int{80, 30}}).Validate(); err == nil {
+		t.Errorf("Expected tiers adding up to more than 100 to be invalid")
+	}
+	if err := (common.PrizeRules{TierSplits: []int{20, 20, 20, 20, 20}}).Validate(); err == nil {
+		t.Errorf("Expected more than 4 tiers to be invalid")
+	}
+}
+
+// TestAmountsRoundTrip tests the wire format of amounts.
+func TestAmountsRoundTrip(t *testing.T) {
+	for text, cents := range map[string]int64{"150": 15000, "150.5": 15050, "0.05": 5} {
+		parsed, err := protocol.ParseAmount(text)
+		if err != nil || parsed != cents {
+			t.Errorf("Expected %s to be %d cents, got %d (%v)", text, cents, parsed, err)
+		}
+	}
+	if formatted := protocol.FormatAmount(15005); formatted != "150.05" {
+		t.Errorf("Expected 150.05, got %s", formatted)
+	}
+	if _, err := protocol.ParseAmount("1.234"); err == nil {
+		t.Errorf("Expected amount with 3 decimals to be invalid")
+	}
+	if _, err := protocol.ParseAmount("92233720368547758"); err == nil {
+		t.Errorf("Expected amount overflowing the cents to be invalid")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestFinishedAgencyReceivesReconciliation tests that an agency signalling it
+// finished gets the amount of stored and rejected bets and their digest.
+func TestFinishedAgencyReceivesReconciliation(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1, 2}})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7500,150.5\n1,first,last,1,2000-12-20,7501\n2,first,last,10000002,2000-12-20,7502", 2)
+	storeBets(t, addr, "1,other,last,10000001,2000-12-21,7574", 1)
+
+	answer := request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	summary, err := protocol.ParseReconciliation(answer)
+	if err != nil {
+		t.Fatalf("Error parsing answer %q: %v", answer, err)
+	}
+
+	digest := protocol.NewBetDigest()
+	digest.Add("first", "last", "10000000", "2000-12-20", 7500, 15050)
+	digest.Add("other", "last", "10000001", "2000-12-21", 7574, 0)
+	expected := protocol.Reconciliation{Stored: 2, Rejected: 1, Digest: digest.Sum()}
+	if summary != expected {
+		t.Errorf("Expected reconciliation %v, got %v", expected, summary)
+	}
+
+	if answer := request(t, addr, protocol.Request("1", protocol.CancelBetRequest, "any")); answer == protocol.BetCancelled {
+		t.Errorf("Expected agency 1 to be finished after reconciling")
+	}
+}
+
+// TestRejectionsCountForTheSendingAgency tests that the rejected bets of a
+// batch are counted for the agency that sent it, whatever agency the
+// rejected bets say they belong to.
+func TestRejectionsCountForTheSendingAgency(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1, 2}})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\nx,first,last\n2,first,last,1,2000-12-20,7575\n", 1)
+
+	if summary := reconcile(t, addr, "1"); summary.Rejected != 2 {
+		t.Errorf("Expected 2 bets of agency 1 rejected, got %v", summary)
+	}
+	if summary := reconcile(t, addr, "2"); summary.Rejected != 0 {
+		t.Errorf("Expected no bets of agency 2 rejected, got %v", summary)
+	}
+}
+
+// TestRejectionsSurviveRestart tests that a server restarted before the
+// agency finishes still reports the bets it rejected.
+func TestRejectionsSurviveRestart(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\n1,first,last,1,2000-12-20,7575\n", 1)
+
+	restarted := startServer(t, common.ServerConfig{Agencies: []int{1}})
+	digest := protocol.NewBetDigest()
+	digest.Add("first", "last", "10000000", "2000-12-20", 7574, 0)
+	expected := protocol.Reconciliation{Stored: 1, Rejected: 1, Digest: digest.Sum()}
+	if summary := reconcile(t, restarted, "1"); summary != expected {
+		t.Errorf("Expected reconciliation %v, got %v", expected, summary)
+	}
+}
+
+// reconcile tells the server the agency finished and returns its answer.
+func reconcile(t *testing.T, addr string, agency string) protocol.Reconciliation {
+	t.Helper()
+	answer := request(t, addr, protocol.Request(agency, protocol.FinishedRequest))
+	summary, err := protocol.ParseReconciliation(answer)
+	if err != nil {
+		t.Fatalf("Error parsing answer %q: %v", answer, err)
+	}
+	return summary
+}
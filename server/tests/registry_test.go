@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestRegistryReadinessDependsOnTheSetOfAgencies tests that an agency finishing
+// twice does not make up for an agency that never finished.
+func TestRegistryReadinessDependsOnTheSetOfAgencies(t *testing.T) {
+	registry := common.NewAgencyRegistry([]int{3, 7})
+
+	registry.MarkFinished(7)
+	registry.MarkFinished(7)
+	if registry.AllFinished() {
+		t.Errorf("Expected registry not to be finished while agency 3 is missing")
+	}
+	if missing := registry.Missing(); len(missing) != 1 || missing[0] != 3 {
+		t.Errorf("Expected missing agencies [3], got %v", missing)
+	}
+
+	registry.MarkFinished(3)
+	if !registry.AllFinished() {
+		t.Errorf("Expected registry to be finished")
+	}
+}
+
+// TestRegistryRejectsUnknownAndDuplicatedAgencies tests that only registered
+// agencies are accepted and that an agency cannot be registered twice.
+func TestRegistryRejectsUnknownAndDuplicatedAgencies(t *testing.T) {
+	registry := common.NewAgencyRegistry([]int{1})
+
+	if registry.IsRegistered(2) {
+		t.Errorf("Expected agency 2 not to be registered")
+	}
+	registry.MarkFinished(2)
+	if registry.HasFinished(2) {
+		t.Errorf("Expected unknown agency 2 not to be marked as finished")
+	}
+	if err := registry.Register(2); err != nil {
+		t.Fatalf("Error registering agency 2: %v", err)
+	}
+	if err := registry.Register(2); err == nil {
+		t.Errorf("Expected registering agency 2 twice to fail")
+	}
+	if !registry.IsRegistered(2) {
+		t.Errorf("Expected agency 2 to be registered")
+	}
+}
+
+// TestParseAgencies tests parsing the list of expected agencies.
+func TestParseAgencies(t *testing.T) {
+	agencies, err := common.ParseAgencies("1, 2,5")
+	if err != nil {
+		t.Fatalf("Error parsing agencies: %v", err)
+	}
+	if len(agencies) != 3 || agencies[0] != 1 || agencies[1] != 2 || agencies[2] != 5 {
+		t.Errorf("Expected agencies [1 2 5], got %v", agencies)
+	}
+	if _, err := common.ParseAgencies("1,1"); err == nil {
+		t.Errorf("Expected duplicated agencies to fail")
+	}
+	if _, err := common.ParseAgencies("1,x"); err == nil {
+		t.Errorf("Expected invalid agency id to fail")
+	}
+}
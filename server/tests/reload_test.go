@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestReloadAppliesMinAge tests that a new min age is used for the bets
+// received after the reload.
+func TestReloadAppliesMinAge(t *testing.T) {
+	config := common.ServerConfig{Agencies: []int{1}, MinAge: 18}
+	server, addr := startServerInstance(t, config)
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+
+	config.MinAge = 150
+	changes, err := server.Reload(config)
+	if err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if !reflect.DeepEqual(changes.Applied, []string{"min_age"}) || len(changes.RestartRequired) != 0 {
+		t.Errorf("Expected only min_age to be applied, got %+v", changes)
+	}
+	ack := storeBets(t, addr, "1,first,last,10000001,2000-12-20,7574", 0)
+	if len(ack.Rejections) != 1 || ack.Rejections[0].Reason != common.ReasonUnderage {
+		t.Errorf("Expected the bet to be rejected as underage, got %v", ack.Rejections)
+	}
+}
+
+// TestReloadReportsRestartRequired tests that the settings that can not
+// change at runtime are reported and keep their value.
+func TestReloadReportsRestartRequired(t *testing.T) {
+	config := common.ServerConfig{Agencies: []int{1}}
+	server, addr := startServerInstance(t, config)
+
+	config.Port = 1
+	config.Agencies = []int{1, 2}
+	changes, err := server.Reload(config)
+	if err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if len(changes.Applied) != 0 || !reflect.DeepEqual(changes.RestartRequired, []string{"server_port", "agencies"}) {
+		t.Errorf("Expected server_port and agencies to require a restart, got %+v", changes)
+	}
+	if answer := request(t, addr, protocol.BatchMessage("2,first,last,10000000,2000-12-20,7574")); answer != "Error: unknown agency 2" {
+		t.Errorf("Expected agency 2 to stay unknown, got %q", answer)
+	}
+}
+
+// TestReloadRejectsInvalidConfig tests that nothing is applied from an
+// invalid configuration.
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	config := common.ServerConfig{Agencies: []int{1}}
+	server, addr := startServerInstance(t, config)
+
+	config.MinAge = 150
+	config.LogLevel = "LOUD"
+	if _, err := server.Reload(config); err == nil {
+		t.Fatalf("Expected an invalid log level to be rejected")
+	}
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+}
+
+// TestReloadReschedulesDrawDeadline tests that setting a draw deadline at
+// runtime performs the draw once it passes.
+func TestReloadReschedulesDrawDeadline(t *testing.T) {
+	config := common.ServerConfig{Agencies: []int{1, 2}}
+	server, addr := startServerInstance(t, config)
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+
+	config.DrawDeadline = 50 * time.Millisecond
+	if _, err := server.Reload(config); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if answer := waitForDraw(t, addr, protocol.Request("1", protocol.WinnersRequest)); answer != "ganadores,\n10000000:0.00" {
+		t.Errorf("Expected the draw to be performed at the new deadline, got %q", answer)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestWinnersCanBeAskedForAgain tests that an agency gets the same winners
+// every time it asks for them, until the contest is archived.
+func TestWinnersCanBeAskedForAgain(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1, 2}})
+	winners := protocol.Request("1", protocol.WinnersRequest)
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	request(t, addr, protocol.Request("2", protocol.FinishedRequest))
+
+	first := waitForDraw(t, addr, winners)
+	if first != "ganadores,\n10000000:0.00" {
+		t.Fatalf("Expected agency 1 winners page with 10000000:0.00, got %q", first)
+	}
+	if again := request(t, addr, winners); again != first {
+		t.Errorf("Expected the same winners when asking again, got %q", again)
+	}
+
+	if err := server.Archive(); err != nil {
+		t.Fatalf("Error archiving contest: %v", err)
+	}
+	answer := request(t, addr, winners)
+	if _, isError := protocol.ParseErrorMessage(answer); !isError {
+		t.Errorf("Expected winners of an archived contest to get an error, got %q", answer)
+	}
+	if _, _, err := common.LoadResults(); err == nil {
+		t.Errorf("Expected the results table to be moved aside when archiving")
+	}
+}
+
+// TestResultsSurviveRestart tests that a server started after the draw
+// serves the results stored by the previous run.
+func TestResultsSurviveRestart(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1, 2, 3}})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574", 1)
+	storeBets(t, addr, "2,first,last,10000001,2000-12-20,1234", 1)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	request(t, addr, protocol.Request("2", protocol.FinishedRequest))
+	request(t, addr, protocol.Request("3", protocol.FinishedRequest))
+	waitForDraw(t, addr, protocol.Request("1", protocol.WinnersRequest))
+
+	restarted := startServer(t, common.ServerConfig{Agencies: []int{1, 2, 3}})
+	if answer := request(t, restarted, protocol.Request("1", protocol.WinnersRequest)); answer != "ganadores,\n10000000:0.00" {
+		t.Errorf("Expected agency 1 winners page with 10000000:0.00, got %q", answer)
+	}
+	if answer := request(t, restarted, protocol.Request("2", protocol.WinnersRequest)); answer != "ganadores,\n" {
+		t.Errorf("Expected an empty winners page for agency 2, got %q", answer)
+	}
+	answer := request(t, restarted, protocol.Request("1", protocol.LookupRequest, "10000000"))
+	if answer != protocol.EncodeBetResults([]protocol.BetResult{{Number: 7574, Won: true}}) {
+		t.Errorf("Expected the lookup to report the winning bet after a restart, got %q", answer)
+	}
+}
+
+// TestPayoutsSurviveRestartWithOtherPrizeRules tests that a server restarted
+// after the draw with other prize rules reports the payouts awarded by the
+// previous run instead of computing them again.
+func TestPayoutsSurviveRestartWithOtherPrizeRules(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574,100\n1,first,last,10000001,2000-12-20,1234,100", 2)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	waitForDraw(t, addr, protocol.Request("1", protocol.WinnersRequest))
+
+	rules := common.PrizeRules{HousePercentage: 50, TierSplits: []int{100}}
+	restarted := startServer(t, common.ServerConfig{Agencies: []int{1}, PrizeRules: rules})
+	if answer := request(t, restarted, protocol.Request("1", protocol.WinnersRequest)); answer != "ganadores,\n10000000:200.00" {
+		t.Errorf("Expected agency 1 winners page with 10000000:200.00, got %q", answer)
+	}
+	answer := request(t, restarted, protocol.Request("1", protocol.LookupRequest, "10000000"))
+	if answer != protocol.EncodeBetResults([]protocol.BetResult{{Number: 7574, Won: true, Payout: 20000}}) {
+		t.Errorf("Expected the lookup to report the payout awarded before the restart, got %q", answer)
+	}
+}
+
+// TestRuntimeAgenciesSurviveRestart tests that an agency registered at
+// runtime can still ask for its winners after a restart.
+func TestRuntimeAgenciesSurviveRestart(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}})
+	if err := server.RegisterAgency(2); err != nil {
+		t.Fatalf("Error registering agency 2: %v", err)
+	}
+
+	storeBets(t, addr, "2,first,last,10000001,2000-12-20,7574", 1)
+	request(t, addr, protocol.Request("1", protocol.FinishedRequest))
+	request(t, addr, protocol.Request("2", protocol.FinishedRequest))
+	waitForDraw(t, addr, protocol.Request("2", protocol.WinnersRequest))
+
+	restarted := startServer(t, common.ServerConfig{Agencies: []int{1}})
+	if answer := request(t, restarted, protocol.Request("2", protocol.WinnersRequest)); answer != "ganadores,\n10000001:0.00" {
+		t.Errorf("Expected agency 2 winners page with 10000001:0.00, got %q", answer)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// waitForConnections waits until the server tracks the given amount of
+// open connections.
+func waitForConnections(t *testing.T, server *common.Server, amount int) {
+	t.Helper()
+	for attempt := 0; len(server.Connections()) != amount && attempt < 100; attempt++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if connections := server.Connections(); len(connections) != amount {
+		t.Fatalf("Expected %d open connections, got %+v", amount, connections)
+	}
+}
+
+// TestGracefulShutdownAnswersOpenSessions tests that a frame sent on a
+// connection opened before the shutdown is answered with an error, and that
+// the shutdown returns as soon as its handler finishes.
+func TestGracefulShutdownAnswersOpenSessions(t *testing.T) {
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}, ShutdownTimeout: 5 * time.Second})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer conn.Close()
+	waitForConnections(t, server, 1)
+
+	start := time.Now()
+	shutdownDone := make(chan struct{})
+	go func() {
+		server.GracefulShutdown()
+		close(shutdownDone)
+	}()
+	for server.IsRunning() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := protocol.SendMessage(conn, protocol.Request("1", protocol.PingRequest)); err != nil {
+		t.Fatalf("Error sending message: %v", err)
+	}
+	answer, err := protocol.ReadReply(conn)
+	if err != nil || answer != protocol.ErrorMessage(protocol.ReasonShuttingDown) {
+		t.Errorf("Expected a shutting down error, got %q (%v)", answer, err)
+	}
+	select {
+	case <-shutdownDone:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the shutdown to finish once the handler did")
+	}
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("Expected the shutdown not to wait for the timeout, took %v", elapsed)
+	}
+}
+
+// TestGracefulShutdownClosesConnectionsAfterTimeout tests that the
+// connections still open when the shutdown timeout passes are closed.
+func TestGracefulShutdownClosesConnectionsAfterTimeout(t *testing.T) {
+	timeout := 100 * time.Millisecond
+	server, addr := startServerInstance(t, common.ServerConfig{Agencies: []int{1}, ShutdownTimeout: timeout})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer conn.Close()
+	waitForConnections(t, server, 1)
+
+	start := time.Now()
+	server.GracefulShutdown()
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("Expected the shutdown to wait for the timeout, took %v", elapsed)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+	if connections := server.Connections(); len(connections) != 0 {
+		t.Errorf("Expected no open connections, got %+v", connections)
+	}
+}
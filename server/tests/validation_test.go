@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	protocol "github.com/7574-sistemas-distribuidos/docker-compose-init/communication_protocol/common"
+	"github.com/7574-sistemas-distribuidos/docker-compose-init/server/common"
+)
+
+// TestValidateBetRejectionReasons tests that each broken rule produces its own reason.
+func TestValidateBetRejectionReasons(t *testing.T) {
+	rules := common.ValidationRules{
+		MinAge: 18,
+		Now: func() time.Time {
+			return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		},
+	}
+	cases := []struct {
+		name   string
+		fields [6]string
+		reason string
+	}{
+		{"valid", [6]string{"1", "first", "last", "10000000", "2000-12-20", "7574"}, ""},
+		{"number too big", [6]string{"1", "first", "last", "10000000", "2000-12-20", "10000"}, common.ReasonNumberOutOfRange},
+		{"negative number", [6]string{"1", "first", "last", "10000000", "2000-12-20", "-1"}, common.ReasonNumberOutOfRange},
+		{"document with letters", [6]string{"1", "first", "last", "1000000A", "2000-12-20", "7574"}, common.ReasonInvalidDocument},
+		{"short document", [6]string{"1", "first", "last", "10000", "2000-12-20", "7574"}, common.ReasonInvalidDocument},
+		{"empty first name", [6]string{"1", " ", "last", "10000000", "2000-12-20", "7574"}, common.ReasonEmptyName},
+		{"empty last name", [6]string{"1", "first", "", "10000000", "2000-12-20", "7574"}, common.ReasonEmptyName},
+		{"future birthdate", [6]string{"1", "first", "last", "10000000", "2024-06-01", "7574"}, common.ReasonFutureBirthdate},
+		{"underage", [6]string{"1", "first", "last", "10000000", "2006-01-02", "7574"}, common.ReasonUnderage},
+	}
+
+	for _, c := range cases {
+		bet, err := common.NewBet(c.fields[0], c.fields[1], c.fields[2], c.fields[3], c.fields[4], c.fields[5])
+		if err != nil {
+			t.Fatalf("%s: error creating Bet: %v", c.name, err)
+		}
+		err = common.ValidateBet(bet, rules)
+		if c.reason == "" {
+			if err != nil {
+				t.Errorf("%s: expected bet to be valid, got %v", c.name, err)
+			}
+			continue
+		}
+		validationErr, ok := err.(*common.BetValidationError)
+		if !ok {
+			t.Errorf("%s: expected a BetValidationError, got %v", c.name, err)
+			continue
+		}
+		if validationErr.Reason != c.reason {
+			t.Errorf("%s: expected reason %s, got %s", c.name, c.reason, validationErr.Reason)
+		}
+	}
+}
+
+// TestServerReturnsRejectionReasons tests that the agency receives the reason
+// of every bet rejected within a batch.
+func TestServerReturnsRejectionReasons(t *testing.T) {
+	addr := startServer(t, common.ServerConfig{Agencies: []int{1}})
+
+	ack := storeBets(t, addr, "1,first,last,10000000,2000-12-20,7574\n1,first,last,10000001,2000-12-20,12345\n1,,last,10000002,2000-12-20,1", 1)
+	expected := []protocol.BetRejection{
+		{Index: 1, Reason: common.ReasonNumberOutOfRange},
+		{Index: 2, Reason: common.ReasonEmptyName},
+	}
+	if len(ack.Rejections) != len(expected) {
+		t.Fatalf("Expected rejections %v, got %v", expected, ack.Rejections)
+	}
+	for i := range expected {
+		if ack.Rejections[i] != expected[i] {
+			t.Errorf("Expected rejection %v, got %v", expected[i], ack.Rejections[i])
+		}
+	}
+}